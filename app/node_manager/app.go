@@ -29,6 +29,7 @@ import (
 	"github.com/streamingfast/node-manager/metrics"
 	"github.com/streamingfast/node-manager/mindreader"
 	"github.com/streamingfast/node-manager/operator"
+	pbnodemanager "github.com/streamingfast/node-manager/pb/sf/node_manager/v1"
 	"github.com/streamingfast/shutter"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -50,6 +51,13 @@ type Modules struct {
 	MindreaderPlugin             *mindreader.MindReaderPlugin
 	RegisterGRPCService          func(server grpc.ServiceRegistrar) error
 	StartFailureHandlerFunc      func()
+
+	// OperatorHTTPOptions are applied to the operator HTTP server, like `Operator.WithAuth`
+	OperatorHTTPOptions []operator.HTTPOption
+
+	// OperatorGRPCAuth protects the NodeManager gRPC service like `Operator.WithAuth`
+	// protects the HTTP server, RPCs changing the node state are rejected when nil
+	OperatorGRPCAuth *operator.AuthConfig
 }
 
 type App struct {
@@ -91,17 +99,17 @@ func (a *App) Run() error {
 		time.Sleep(a.config.StartupDelay)
 	}
 
-	var httpOptions []operator.HTTPOption
-	if hasMindreader {
-		if err := a.startMindreader(); err != nil {
-			return fmt.Errorf("unable to start mindreader: %w", err)
+	if hasMindreader || a.config.GRPCAddr != "" {
+		if err := a.startGRPCServer(); err != nil {
+			return fmt.Errorf("unable to start gRPC server: %w", err)
 		}
-
 	}
 
+	a.setOperatorStatusSources()
+
 	a.zlogger.Info("launching operator")
 	go a.modules.MetricsAndReadinessManager.Launch()
-	go a.Shutdown(a.modules.Operator.Launch(a.config.HTTPAddr, httpOptions...))
+	go a.Shutdown(a.modules.Operator.Launch(a.config.HTTPAddr, a.modules.OperatorHTTPOptions...))
 
 	if a.config.ConnectionWatchdog {
 		go a.modules.LaunchConnectionWatchdogFunc(a.Terminating())
@@ -110,7 +118,28 @@ func (a *App) Run() error {
 	return nil
 }
 
+// setOperatorStatusSources completes the operator status and readiness with the head
+// block and the uploader backlog of the modules, when configured
+func (a *App) setOperatorStatusSources() {
+	var headBlock operator.HeadBlockSource
+	if a.modules.MetricsAndReadinessManager != nil {
+		headBlock = a.modules.MetricsAndReadinessManager
+	}
+
+	var uploaderBacklog operator.UploaderBacklogSource
+	if a.modules.MindreaderPlugin != nil {
+		uploaderBacklog = a.modules.MindreaderPlugin
+	}
+
+	a.modules.Operator.SetStatusSources(headBlock, uploaderBacklog)
+}
+
 func (a *App) IsReady() bool {
+	// Querying ourself would require a client certificate when mTLS is enabled
+	if a.modules.Operator.TLSEnabled() {
+		return a.modules.Operator.IsReady()
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
 
@@ -131,9 +160,16 @@ func (a *App) IsReady() bool {
 	return res.StatusCode == 200
 }
 
-func (a *App) startMindreader() error {
-	a.zlogger.Info("starting mindreader gRPC server")
-	gs := dgrpcfactory.ServerFromOptions(dgrpcserver.WithLogger(a.zlogger))
+func (a *App) startGRPCServer() error {
+	a.zlogger.Info("starting gRPC server")
+	nodeManagerServer := operator.NewNodeManagerServer(a.modules.Operator, a.modules.OperatorGRPCAuth)
+	a.modules.Operator.Superviser.RegisterLogPlugin(nodeManagerServer.LogPlugin())
+
+	gs := dgrpcfactory.ServerFromOptions(
+		dgrpcserver.WithLogger(a.zlogger),
+		dgrpcserver.WithPostUnaryInterceptor(nodeManagerServer.UnaryInterceptor()),
+		dgrpcserver.WithPostStreamInterceptor(nodeManagerServer.StreamInterceptor()),
+	)
 
 	if a.modules.RegisterGRPCService != nil {
 		err := a.modules.RegisterGRPCService(gs.ServiceRegistrar())
@@ -142,6 +178,8 @@ func (a *App) startMindreader() error {
 		}
 	}
 
+	pbnodemanager.RegisterNodeManagerServer(gs.ServiceRegistrar(), nodeManagerServer)
+
 	gs.OnTerminated(a.Shutdown)
 
 	// Launch is blocking and we don't want to block in this method
@@ -0,0 +1,69 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodemanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	nodeManager "github.com/streamingfast/node-manager"
+	"github.com/streamingfast/node-manager/mindreader"
+	"github.com/streamingfast/node-manager/operator"
+	"github.com/streamingfast/shutter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testSuperviser struct {
+	nodeManager.ChainSuperviser
+	shutter *shutter.Shutter
+}
+
+func (s *testSuperviser) Shutdown(err error)          { s.shutter.Shutdown(err) }
+func (s *testSuperviser) OnTerminating(f func(error)) { s.shutter.OnTerminating(f) }
+func (s *testSuperviser) OnTerminated(f func(error))  { s.shutter.OnTerminated(f) }
+func (s *testSuperviser) IsTerminating() bool         { return s.shutter.IsTerminating() }
+func (s *testSuperviser) IsTerminated() bool          { return s.shutter.IsTerminated() }
+func (s *testSuperviser) Terminated() <-chan struct{} { return s.shutter.Terminated() }
+
+func (s *testSuperviser) GetName() string          { return "test" }
+func (s *testSuperviser) IsRunning() bool          { return true }
+func (s *testSuperviser) LastExitCode() int        { return 0 }
+func (s *testSuperviser) LastSeenBlockNum() uint64 { return 0 }
+
+func TestApp_StatusSources(t *testing.T) {
+	manager := nodeManager.NewMetricsAndReadinessManager(nil, nil, nil, 0)
+	go manager.Launch()
+
+	dir := t.TempDir()
+	mindreaderPlugin, err := mindreader.NewMindReaderPlugin("file://"+dir+"/one-blocks", dir+"/work", nil, 0, 0, 10, nil, nil, "default", nil, zap.NewNop(), nil)
+	require.NoError(t, err)
+
+	op, err := operator.New(zap.NewNop(), &testSuperviser{shutter: shutter.New()}, manager, &operator.Options{})
+	require.NoError(t, err)
+
+	app := New(&Config{}, &Modules{Operator: op, MetricsAndReadinessManager: manager, MindreaderPlugin: mindreaderPlugin}, zap.NewNop())
+	app.setOperatorStatusSources()
+
+	require.NoError(t, manager.UpdateHeadBlock(&bstream.Block{Id: "00000010a", Number: 10}))
+	require.Eventually(t, func() bool { return op.Status().HeadBlock != nil }, 5*time.Second, 10*time.Millisecond)
+
+	status := op.Status()
+	assert.Equal(t, "00000010a", status.HeadBlock.ID)
+	require.NotNil(t, status.UploaderBacklog, "uploader backlog comes from the mindreader plugin")
+	assert.Equal(t, 0, *status.UploaderBacklog)
+}
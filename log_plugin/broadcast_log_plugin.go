@@ -0,0 +1,95 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logplugin
+
+import (
+	"sync"
+)
+
+// BroadcastLogPlugin forwards the log lines to its subscribers, instrumentation
+// lines excluded. Subscribers not keeping up miss the lines logged while their
+// buffer is full, the process is never slowed down by them.
+type BroadcastLogPlugin struct {
+	lock        sync.RWMutex
+	subscribers map[*LogSubscription]struct{}
+}
+
+type LogSubscription struct {
+	lines   chan string
+	dropped uint64
+}
+
+// Lines receives the log lines, it is closed when the subscription is canceled
+func (s *LogSubscription) Lines() <-chan string {
+	return s.lines
+}
+
+func NewBroadcastLogPlugin() *BroadcastLogPlugin {
+	return &BroadcastLogPlugin{
+		subscribers: map[*LogSubscription]struct{}{},
+	}
+}
+
+func (p *BroadcastLogPlugin) Name() string {
+	return "BroadcastLogPlugin"
+}
+func (p *BroadcastLogPlugin) Launch()             {}
+func (p *BroadcastLogPlugin) Stop()               {}
+func (p *BroadcastLogPlugin) Shutdown(_ error)    {}
+func (p *BroadcastLogPlugin) IsTerminating() bool { return false }
+
+// Subscribe starts forwarding the log lines to a new subscription buffering up
+// to `bufferSize` lines, `Unsubscribe` must be called once done with it.
+func (p *BroadcastLogPlugin) Subscribe(bufferSize int) *LogSubscription {
+	sub := &LogSubscription{lines: make(chan string, bufferSize)}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops forwarding lines to `sub` and returns the number of lines it missed
+func (p *BroadcastLogPlugin) Unsubscribe(sub *LogSubscription) (dropped uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, found := p.subscribers[sub]; !found {
+		return sub.dropped
+	}
+
+	delete(p.subscribers, sub)
+	close(sub.lines)
+	return sub.dropped
+}
+
+func (p *BroadcastLogPlugin) LogLine(in string) {
+	if readerInstrumentationPrefixRegex.MatchString(in) {
+		return
+	}
+
+	// Write lock since the dropped counters are updated
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for sub := range p.subscribers {
+		select {
+		case sub.lines <- in:
+		default:
+			sub.dropped++
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logplugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcastLogPlugin(t *testing.T) {
+	plugin := NewBroadcastLogPlugin()
+
+	plugin.LogLine("before subscription")
+
+	sub := plugin.Subscribe(2)
+	plugin.LogLine("a")
+	plugin.LogLine("DMLOG skipped")
+	plugin.LogLine("b")
+	plugin.LogLine("c")
+
+	assert.Equal(t, uint64(1), plugin.Unsubscribe(sub))
+	plugin.LogLine("after unsubscription")
+
+	var lines []string
+	for line := range sub.Lines() {
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{"a", "b"}, lines)
+}
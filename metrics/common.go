@@ -31,3 +31,15 @@ func NewHeadBlockNumber(serviceName string) *dmetrics.HeadBlockNum {
 func NewAppReadiness(serviceName string) *dmetrics.AppReadiness {
 	return Metricset.NewAppReadiness(serviceName)
 }
+
+var ProcessRestarts = Metricset.NewCounterVec("node_process_restarts", []string{"instance"}, "Number of times the supervised process was restarted after stopping on its own")
+var ProcessRestartsInWindow = Metricset.NewGaugeVec("node_process_restarts_in_window", []string{"instance"}, "Number of restarts counted against the restart policy budget")
+
+var BackupsPruned = Metricset.NewCounterVec("node_backups_pruned", []string{"backuper_name"}, "Number of backups deleted by the retention policy")
+
+var ProcessCPUSeconds = Metricset.NewGaugeVec("node_process_cpu_seconds", []string{"instance"}, "User and system CPU time consumed by the supervised process since it started")
+var ProcessResidentMemory = Metricset.NewGaugeVec("node_process_resident_memory_bytes", []string{"instance"}, "Resident memory size of the supervised process")
+var ProcessOpenFDs = Metricset.NewGaugeVec("node_process_open_fds", []string{"instance"}, "Number of file descriptors opened by the supervised process")
+var ProcessThreads = Metricset.NewGaugeVec("node_process_threads", []string{"instance"}, "Number of threads of the supervised process")
+var ProcessIOReadBytes = Metricset.NewGaugeVec("node_process_io_read_bytes", []string{"instance"}, "Bytes read from storage by the supervised process since it started")
+var ProcessIOWriteBytes = Metricset.NewGaugeVec("node_process_io_write_bytes", []string{"instance"}, "Bytes written to storage by the supervised process since it started")
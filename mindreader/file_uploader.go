@@ -9,6 +9,7 @@ import (
 	"github.com/abourget/llerrgroup"
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/shutter"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
@@ -19,12 +20,20 @@ type FileUploader struct {
 	destinationStore dstore.Store
 	logger           *zap.Logger
 	complete         chan struct{}
+
+	// backlog counts the files left waiting by the latest completed upload pass, the
+	// ones skipped once an upload failed and the failed ones, failed counting the latter.
+	// Both are only updated once a pass completes so they do not drop while files are counted.
+	backlog *atomic.Int64
+	failed  *atomic.Int64
 }
 
 func NewFileUploader(localStore dstore.Store, destinationStore dstore.Store, logger *zap.Logger) *FileUploader {
 	return &FileUploader{
 		Shutter:          shutter.New(),
 		complete:         make(chan struct{}),
+		backlog:          atomic.NewInt64(0),
+		failed:           atomic.NewInt64(0),
 		localStore:       localStore,
 		destinationStore: destinationStore,
 		logger:           logger,
@@ -46,7 +55,7 @@ func (fu *FileUploader) Start(ctx context.Context) {
 	for {
 		err := fu.uploadFiles(ctx)
 		if err != nil {
-			fu.logger.Warn("failed to upload file", zap.Error(err))
+			fu.logger.Warn("failed to upload file", zap.Error(err), zap.Int64("failed_uploads", fu.failed.Load()))
 		}
 
 		if terminating {
@@ -66,11 +75,17 @@ func (fu *FileUploader) uploadFiles(ctx context.Context) error {
 	fu.mutex.Lock()
 	defer fu.mutex.Unlock()
 
+	var found int64
+	uploaded, failed := atomic.NewInt64(0), atomic.NewInt64(0)
+
 	eg := llerrgroup.New(200)
-	_ = fu.localStore.Walk(ctx, "", func(filename string) (err error) {
+	_ = fu.localStore.Walk(ctx, "", func(filename string) error {
+		// Files skipped once an upload failed are still waiting
+		found++
 		if eg.Stop() {
 			return nil
 		}
+
 		eg.Go(func() error {
 			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
 			defer cancel()
@@ -79,14 +94,27 @@ func (fu *FileUploader) uploadFiles(ctx context.Context) error {
 				fu.logger.Debug("uploading file to storage", zap.String("local_file", filename))
 			}
 
-			if err = fu.destinationStore.PushLocalFile(ctx, fu.localStore.ObjectPath(filename), filename); err != nil {
+			if err := fu.destinationStore.PushLocalFile(ctx, fu.localStore.ObjectPath(filename), filename); err != nil {
+				failed.Inc()
 				return fmt.Errorf("moving file %q to storage: %w", filename, err)
 			}
+
+			uploaded.Inc()
 			return nil
 		})
 
 		return nil
 	})
 
-	return eg.Wait()
+	err := eg.Wait()
+	fu.backlog.Store(found - uploaded.Load())
+	fu.failed.Store(failed.Load())
+
+	return err
+}
+
+// Backlog returns the amount of files waiting to be uploaded, as left by the latest
+// upload pass, including the ones whose upload failed
+func (fu *FileUploader) Backlog() int {
+	return int(fu.backlog.Load())
 }
@@ -2,10 +2,12 @@ package mindreader
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -41,3 +43,39 @@ func TestFileUploader(t *testing.T) {
 		t.Error("took took long")
 	}
 }
+
+func TestFileUploader_Backlog(t *testing.T) {
+	localStore := dstore.NewMockStore(nil)
+	localStore.SetFile("test1", nil)
+	localStore.SetFile("test2", nil)
+	localStore.SetFile("test3", nil)
+
+	destinationStore := dstore.NewMockStore(nil)
+	destinationStore.PushLocalFileFunc = func(_ context.Context, _, remoteName string) error {
+		if remoteName == "test3" {
+			return fmt.Errorf("store unavailable")
+		}
+		return nil
+	}
+
+	uploader := NewFileUploader(localStore, destinationStore, testLogger)
+	require.Error(t, uploader.uploadFiles(context.Background()))
+
+	assert.EqualValues(t, 1, uploader.failed.Load())
+	assert.Equal(t, 1, uploader.Backlog())
+
+	// The backlog of the previous pass is kept while the next one counts the files
+	counted := make(chan struct{})
+	destinationStore.PushLocalFileFunc = func(_ context.Context, _, _ string) error {
+		<-counted
+		return nil
+	}
+
+	done := make(chan error)
+	go func() { done <- uploader.uploadFiles(context.Background()) }()
+	assert.Never(t, func() bool { return uploader.Backlog() != 1 }, 50*time.Millisecond, 5*time.Millisecond)
+	close(counted)
+
+	require.NoError(t, <-done)
+	assert.Equal(t, 0, uploader.Backlog())
+}
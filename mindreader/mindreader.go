@@ -203,7 +203,7 @@ func (p *MindReaderPlugin) launch() {
 	}()
 }
 
-func (p MindReaderPlugin) Stop() {
+func (p *MindReaderPlugin) Stop() {
 	p.zlogger.Info("mindreader is stopping")
 	if p.lines == nil {
 		// If the `lines` channel was not created yet, it means everything was shut down very rapidly
@@ -355,3 +355,8 @@ func (p *MindReaderPlugin) LastSeenBlock() bstream.BlockRef {
 
 	return p.lastSeenBlock
 }
+
+// UploaderBacklog returns the amount of one block files waiting to be uploaded
+func (p *MindReaderPlugin) UploaderBacklog() int {
+	return p.archiver.fileUploader.Backlog()
+}
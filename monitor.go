@@ -1,6 +1,7 @@
 package node_manager
 
 import (
+	"sync"
 	"time"
 
 	"github.com/streamingfast/bstream"
@@ -24,6 +25,10 @@ type MetricsAndReadinessManager struct {
 	// now before /healthz starts returning success
 	readinessMaxLatency time.Duration
 
+	lastHeadBlock     bstream.BlockRef
+	lastHeadBlockTime time.Time
+	lastHeadBlockLock sync.RWMutex
+
 	logger *zap.Logger
 }
 
@@ -65,6 +70,11 @@ func (m *MetricsAndReadinessManager) Launch() {
 			continue
 		}
 
+		m.lastHeadBlockLock.Lock()
+		m.lastHeadBlock = lastSeenBlock.AsRef()
+		m.lastHeadBlockTime = lastSeenBlock.Time()
+		m.lastHeadBlockLock.Unlock()
+
 		// metrics
 		if m.headBlockNumber != nil {
 			m.headBlockNumber.SetUint64(lastSeenBlock.Num())
@@ -86,6 +96,14 @@ func (m *MetricsAndReadinessManager) Launch() {
 	}
 }
 
+// LastHeadBlock returns the latest head block processed, `ref` is nil when none was seen yet
+func (m *MetricsAndReadinessManager) LastHeadBlock() (ref bstream.BlockRef, blockTime time.Time) {
+	m.lastHeadBlockLock.RLock()
+	defer m.lastHeadBlockLock.RUnlock()
+
+	return m.lastHeadBlock, m.lastHeadBlockTime
+}
+
 func (m *MetricsAndReadinessManager) UpdateHeadBlock(block *bstream.Block) error {
 	m.headBlockChan <- block
 	return nil
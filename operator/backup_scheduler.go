@@ -0,0 +1,189 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cronCheckInterval bounds how long the cron scheduler sleeps at once, so wall
+// clock adjustments and host suspensions are noticed within that delay.
+const cronCheckInterval = time.Minute
+
+// launchedSchedule is a `BackupSchedule` enabled on this host, it keeps track of
+// its planned and last runs so they can be exposed.
+type launchedSchedule struct {
+	*BackupSchedule
+
+	lock    sync.Mutex
+	nextRun time.Time
+	lastRun time.Time
+}
+
+// BackupScheduleStatus is the JSON representation of an enabled backup schedule
+type BackupScheduleStatus struct {
+	BackuperName      string     `json:"backuper_name"`
+	BlocksBetweenRuns int        `json:"blocks_between_runs,omitempty"`
+	TimeBetweenRuns   string     `json:"time_between_runs,omitempty"`
+	Cron              string     `json:"cron,omitempty"`
+	NextRun           *time.Time `json:"next_run,omitempty"`
+	LastRun           *time.Time `json:"last_run,omitempty"`
+}
+
+func (s *launchedSchedule) setNextRun(next time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.nextRun = next
+}
+
+func (s *launchedSchedule) setLastRun(last time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastRun = last
+}
+
+func (s *launchedSchedule) Status() *BackupScheduleStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := &BackupScheduleStatus{
+		BackuperName:      s.BackuperName,
+		BlocksBetweenRuns: s.BlocksBetweenRuns,
+	}
+
+	if s.TimeBetweenRuns > 0 {
+		status.TimeBetweenRuns = s.TimeBetweenRuns.String()
+	}
+
+	if s.Cron != nil {
+		status.Cron = s.Cron.String()
+	}
+
+	if !s.nextRun.IsZero() {
+		nextRun := s.nextRun
+		status.NextRun = &nextRun
+	}
+
+	if !s.lastRun.IsZero() {
+		lastRun := s.lastRun
+		status.LastRun = &lastRun
+	}
+
+	return status
+}
+
+func (o *Operator) backupScheduleStatuses() []*BackupScheduleStatus {
+	o.launchedSchedulesLock.Lock()
+	defer o.launchedSchedulesLock.Unlock()
+
+	statuses := make([]*BackupScheduleStatus, len(o.launchedSchedules))
+	for i, sched := range o.launchedSchedules {
+		statuses[i] = sched.Status()
+	}
+
+	return statuses
+}
+
+// RunOnCron queues a scheduled backup each time the wall clock matches the cron
+// expression of the schedule. When the schedule does not skip missed runs, a
+// backup is queued right away if a planned run was missed since the latest backup
+// of the module, e.g. because the operator was down at that time.
+func (o *Operator) RunOnCron(sched *launchedSchedule) {
+	params := map[string]string{"name": sched.BackuperName}
+	logger := o.zlogger.With(zap.String("backuper_name", sched.BackuperName), zap.Stringer("cron", sched.Cron))
+
+	for !o.Superviser.IsRunning() {
+		select {
+		case <-o.Terminating():
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if !sched.SkipMissedRun {
+		if missed, lastBackup := o.missedCronRun(sched, time.Now()); missed {
+			logger.Info("planned backup was missed since latest backup, running it now", zap.Time("latest_backup", lastBackup))
+			sched.setLastRun(time.Now())
+			o.enqueueScheduled("backup", params)
+		}
+	}
+
+	for {
+		next := sched.Cron.Next(time.Now())
+		if next.IsZero() {
+			logger.Error("cron expression never matches, disabling backup schedule")
+			sched.setNextRun(time.Time{})
+			return
+		}
+		sched.setNextRun(next)
+
+		for now := time.Now(); now.Before(next); now = time.Now() {
+			wait := next.Sub(now)
+			if wait > cronCheckInterval {
+				wait = cronCheckInterval
+			}
+
+			select {
+			case <-o.Terminating():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		if !o.Superviser.IsRunning() {
+			logger.Info("skipping planned backup, process is not running", zap.Time("planned_run", next))
+			continue
+		}
+
+		sched.setLastRun(time.Now())
+		o.enqueueScheduled("backup", params)
+	}
+}
+
+// missedCronRun reports if a run was planned between the latest backup of the
+// scheduled module and `now`. Modules that cannot list their backups, or without
+// any backup yet, never have missed runs.
+func (o *Operator) missedCronRun(sched *launchedSchedule, now time.Time) (bool, time.Time) {
+	listable, ok := o.backupModules[sched.BackuperName].(ListableBackupModule)
+	if !ok {
+		o.zlogger.Debug("backup module cannot list backups, cannot detect missed cron runs", zap.String("backuper_name", sched.BackuperName))
+		return false, time.Time{}
+	}
+
+	backups, err := listable.ListBackups()
+	if err != nil {
+		o.zlogger.Warn("unable to list backups to detect missed cron runs", zap.String("backuper_name", sched.BackuperName), zap.Error(err))
+		return false, time.Time{}
+	}
+
+	var latest time.Time
+	for _, backup := range backups {
+		if backup.Timestamp.After(latest) {
+			latest = backup.Timestamp
+		}
+	}
+
+	if latest.IsZero() {
+		return false, latest
+	}
+
+	planned := sched.Cron.Next(latest.In(now.Location()))
+	return !planned.IsZero() && planned.Before(now), latest
+}
@@ -1,8 +1,10 @@
 package operator
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +16,12 @@ type BackupModuleConfig map[string]string
 
 type BackupModuleFactory func(conf BackupModuleConfig) (BackupModule, error)
 
+// builtinBackupModuleFactories are used by `ParseBackupConfigs` when no factory was
+// given for a backup module type.
+var builtinBackupModuleFactories = map[string]BackupModuleFactory{
+	"tarball": TarballBackupModuleFactory,
+}
+
 type BackupModule interface {
 	Backup(lastSeenBlockNum uint32) (string, error)
 	RequiresStop() bool
@@ -24,11 +32,78 @@ type RestorableBackupModule interface {
 	Restore(name string) error
 }
 
+// ContextBackupModule performs backups that can be aborted through `ctx`, either
+// when the command is canceled or when it times out.
+type ContextBackupModule interface {
+	BackupModule
+	BackupWithContext(ctx context.Context, lastSeenBlockNum uint32) (string, error)
+}
+
+// ContextRestorableBackupModule performs restores that can be aborted through `ctx`.
+// An aborted restore must leave the data of the node usable, since the node is
+// restarted right after.
+type ContextRestorableBackupModule interface {
+	RestorableBackupModule
+	RestoreWithContext(ctx context.Context, name string) error
+}
+
+// VerifiableBackupModule can check the integrity of a backup before it gets restored,
+// usually by comparing it against the `BackupManifest` written at backup time.
+// The verification is aborted when `ctx` is done.
+type VerifiableBackupModule interface {
+	RestorableBackupModule
+	Verify(ctx context.Context, name string) error
+}
+
+type BackupInfo struct {
+	// Module is the name under which the backup module is registered, filled by the operator
+	Module    string    `json:"module,omitempty"`
+	Name      string    `json:"name"`
+	BlockNum  uint64    `json:"block_num"`
+	Size      int64     `json:"size"`
+	Timestamp time.Time `json:"timestamp"`
+	Tags      []string  `json:"tags,omitempty"`
+}
+
+type ListableBackupModule interface {
+	BackupModule
+	ListBackups() ([]*BackupInfo, error)
+}
+
+// DescribableBackupModule lists its backups without reading their details, only the
+// name, block number and, when known, timestamp are filled. The `list` command reads
+// the details of the backups it returns only.
+type DescribableBackupModule interface {
+	ListableBackupModule
+	ListBackupNames() ([]*BackupInfo, error)
+	// DescribeBackup fills the details of a backup returned by `ListBackupNames`
+	DescribeBackup(backup *BackupInfo) error
+}
+
+// PrunableBackupModule is required by backup modules configured with a retention policy
+type PrunableBackupModule interface {
+	ListableBackupModule
+	DeleteBackup(name string) error
+}
+
+// BackupListing is the paginated result of the `list` command
+type BackupListing struct {
+	Backups []*BackupInfo `json:"backups"`
+	Total   int           `json:"total"`
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"`
+}
+
+const defaultBackupListingLimit = 100
+
 type BackupSchedule struct {
 	BlocksBetweenRuns     int
 	TimeBetweenRuns       time.Duration
-	RequiredHostnameMatch string // will not run backup if !empty env.Hostname != HostnameMatch
-	BackuperName          string // must match id of backupModule
+	Cron                  *CronSchedule    // runs at the wall-clock times (local time) matching the expression
+	SkipMissedRun         bool             // for cron schedules, do not catch up a planned run missed while the operator was down
+	RequiredHostnameMatch string           // will not run backup if !empty env.Hostname != HostnameMatch
+	BackuperName          string           // must match id of backupModule
+	Retention             *RetentionPolicy // applied after each successful scheduled backup, when set
 }
 
 func (o *Operator) RegisterBackupModule(name string, mod BackupModule) error {
@@ -48,6 +123,24 @@ func (o *Operator) RegisterBackupSchedule(sched *BackupSchedule) {
 	o.backupSchedules = append(o.backupSchedules, sched)
 }
 
+// backupWithContext uses the context-aware variant of the module when available,
+// other modules cannot be aborted and run to completion.
+func backupWithContext(ctx context.Context, mod BackupModule, lastSeenBlockNum uint32) (string, error) {
+	if contextMod, ok := mod.(ContextBackupModule); ok {
+		return contextMod.BackupWithContext(ctx, lastSeenBlockNum)
+	}
+
+	return mod.Backup(lastSeenBlockNum)
+}
+
+func restoreWithContext(ctx context.Context, mod RestorableBackupModule, name string) error {
+	if contextMod, ok := mod.(ContextRestorableBackupModule); ok {
+		return contextMod.RestoreWithContext(ctx, name)
+	}
+
+	return mod.Restore(name)
+}
+
 func selectBackupModule(mods map[string]BackupModule, optionalName string) (BackupModule, error) {
 	if len(mods) == 0 {
 		return nil, fmt.Errorf("no registered backup modules")
@@ -105,6 +198,172 @@ func selectRestoreModule(choices map[string]BackupModule, optionalName string) (
 
 }
 
+// listBackups returns the backups of every listable module (or only the one named
+// `optionalName`), from the highest block to the lowest one.
+func listBackups(mods map[string]BackupModule, optionalName string, offset, limit int) (*BackupListing, error) {
+	var backups []*BackupInfo
+	describables := map[string]DescribableBackupModule{}
+	found := false
+	for name, mod := range mods {
+		if optionalName != "" && name != optionalName {
+			continue
+		}
+
+		listable, ok := mod.(ListableBackupModule)
+		if !ok {
+			continue
+		}
+		found = true
+
+		var modBackups []*BackupInfo
+		var err error
+		if describable, ok := mod.(DescribableBackupModule); ok {
+			describables[name] = describable
+			modBackups, err = describable.ListBackupNames()
+		} else {
+			modBackups, err = listable.ListBackups()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("listing backups of module %q: %w", name, err)
+		}
+
+		for _, backup := range modBackups {
+			backup.Module = name
+			backups = append(backups, backup)
+		}
+	}
+
+	if !found {
+		if optionalName != "" {
+			return nil, fmt.Errorf("invalid listable backup module: %s", optionalName)
+		}
+		return nil, fmt.Errorf("none of the registered backup modules support 'list'")
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		if backups[i].BlockNum != backups[j].BlockNum {
+			return backups[i].BlockNum > backups[j].BlockNum
+		}
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+
+	listing := &BackupListing{Backups: []*BackupInfo{}, Total: len(backups), Offset: offset, Limit: limit}
+	if offset < len(backups) {
+		end := offset + limit
+		if end > len(backups) {
+			end = len(backups)
+		}
+		listing.Backups = backups[offset:end]
+	}
+
+	for _, backup := range listing.Backups {
+		if describable, ok := describables[backup.Module]; ok {
+			if err := describable.DescribeBackup(backup); err != nil {
+				return nil, fmt.Errorf("describing backup %q of module %q: %w", backup.Name, backup.Module, err)
+			}
+		}
+	}
+
+	return listing, nil
+}
+
+// resolveRestoreBackupName finds the backup to restore from the `backupName`,
+// `blockNum` and `backupTag` restore parameters, defaulting to "latest".
+func resolveRestoreBackupName(mod RestorableBackupModule, params map[string]string) (string, error) {
+	backupName := params["backupName"]
+	blockNumStr := params["blockNum"]
+	tag := params["backupTag"]
+
+	if backupName != "" {
+		if blockNumStr != "" || tag != "" {
+			return "", fmt.Errorf("backupName cannot be combined with blockNum or backupTag")
+		}
+		return backupName, nil
+	}
+
+	if blockNumStr == "" && tag == "" {
+		return "latest", nil
+	}
+
+	var maxBlockNum *uint64
+	if blockNumStr != "" {
+		blockNum, err := strconv.ParseUint(blockNumStr, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid blockNum %q: %w", blockNumStr, err)
+		}
+		maxBlockNum = &blockNum
+	}
+
+	listable, ok := mod.(ListableBackupModule)
+	if !ok {
+		return "", fmt.Errorf("backup module does not support listing backups, cannot select backup by blockNum or backupTag")
+	}
+
+	backups, err := listable.ListBackups()
+	if err != nil {
+		return "", fmt.Errorf("listing backups: %w", err)
+	}
+
+	backup := selectBackup(backups, maxBlockNum, tag)
+	if backup == nil {
+		return "", fmt.Errorf("no backup found matching blockNum %q and backupTag %q", blockNumStr, tag)
+	}
+
+	return backup.Name, nil
+}
+
+// selectBackup returns the newest backup at or below `maxBlockNum` (when non-nil)
+// having the `tag` (when non-empty), nil if none matches.
+func selectBackup(backups []*BackupInfo, maxBlockNum *uint64, tag string) (selected *BackupInfo) {
+	for _, backup := range backups {
+		if maxBlockNum != nil && backup.BlockNum > *maxBlockNum {
+			continue
+		}
+
+		if tag != "" && !hasTag(backup, tag) {
+			continue
+		}
+
+		if selected == nil ||
+			backup.BlockNum > selected.BlockNum ||
+			(backup.BlockNum == selected.BlockNum && backup.Timestamp.After(selected.Timestamp)) {
+			selected = backup
+		}
+	}
+
+	return
+}
+
+func hasTag(backup *BackupInfo, tag string) bool {
+	for _, t := range backup.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePagination(params map[string]string) (offset, limit int, err error) {
+	limit = defaultBackupListingLimit
+	if v := params["offset"]; v != "" {
+		value, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid offset %q: %w", v, err)
+		}
+		offset = int(value)
+	}
+
+	if v := params["limit"]; v != "" {
+		value, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || value == 0 {
+			return 0, 0, fmt.Errorf("invalid limit %q, must be a positive integer", v)
+		}
+		limit = int(value)
+	}
+
+	return offset, limit, nil
+}
+
 func restorable(in map[string]BackupModule) map[string]RestorableBackupModule {
 	out := make(map[string]RestorableBackupModule)
 	for k, v := range in {
@@ -146,6 +405,21 @@ func NewBackupSchedule(freqBlocks, freqTime, requiredHostname, backuperName stri
 	}
 }
 
+// NewCronBackupSchedule creates a schedule running at the wall-clock times matching
+// the `freqCron` expression, see `ParseCronSchedule`.
+func NewCronBackupSchedule(freqCron, requiredHostname, backuperName string) (*BackupSchedule, error) {
+	cron, err := ParseCronSchedule(freqCron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for freq_cron in backup schedule (err: %w)", err)
+	}
+
+	return &BackupSchedule{
+		Cron:                  cron,
+		RequiredHostnameMatch: requiredHostname,
+		BackuperName:          backuperName,
+	}, nil
+}
+
 func ParseBackupConfigs(
 	logger *zap.Logger,
 	backupConfigs []string,
@@ -169,6 +443,9 @@ func ParseBackupConfigs(
 
 		t := conf["type"]
 		factory, found := backupModuleFactories[t]
+		if !found {
+			factory, found = builtinBackupModuleFactories[t]
+		}
 		if !found {
 			return nil, nil, fmt.Errorf("unknown backup module type %q", t)
 		}
@@ -178,13 +455,45 @@ func ParseBackupConfigs(
 			return nil, nil, fmt.Errorf("backup module %q factory: %w", t, err)
 		}
 
-		if conf["freq-blocks"] != "" || conf["freq-time"] != "" {
-			newSched, err := NewBackupSchedule(conf["freq-blocks"], conf["freq-time"], conf["required-hostname"], t)
+		retention, err := NewRetentionPolicy(conf["keep-last"], conf["keep-daily"], conf["keep-weekly"])
+		if err != nil {
+			return nil, nil, fmt.Errorf("error setting up retention policy for %q: %w", t, err)
+		}
+
+		if retention != nil {
+			if _, ok := mods[t].(PrunableBackupModule); !ok {
+				return nil, nil, fmt.Errorf("backup module %q does not support pruning, cannot use keep-last, keep-daily or keep-weekly", t)
+			}
+		}
+
+		if conf["freq-cron"] != "" && (conf["freq-blocks"] != "" || conf["freq-time"] != "") {
+			return nil, nil, fmt.Errorf("backup schedule for %q cannot combine freq-cron with freq-blocks or freq-time", t)
+		}
+
+		if conf["freq-blocks"] != "" || conf["freq-time"] != "" || conf["freq-cron"] != "" {
+			var newSched *BackupSchedule
+			var err error
+			if conf["freq-blocks"] != "" || conf["freq-time"] != "" {
+				newSched, err = NewBackupSchedule(conf["freq-blocks"], conf["freq-time"], conf["required-hostname"], t)
+			} else {
+				newSched, err = NewCronBackupSchedule(conf["freq-cron"], conf["required-hostname"], t)
+			}
 			if err != nil {
 				return nil, nil, fmt.Errorf("error setting up backup schedule for %q: %w", t, err)
 			}
+			newSched.Retention = retention
+
+			switch conf["cron-missed-run"] {
+			case "", "run":
+			case "skip":
+				newSched.SkipMissedRun = true
+			default:
+				return nil, nil, fmt.Errorf("invalid cron-missed-run %q for %q, accepted values are 'run' and 'skip'", conf["cron-missed-run"], t)
+			}
 
 			scheds = append(scheds, newSched)
+		} else if retention != nil {
+			return nil, nil, fmt.Errorf("retention policy for %q is only applied on scheduled backups, freq-blocks, freq-time or freq-cron is required", t)
 		}
 	}
 
@@ -197,7 +506,7 @@ func parseKVConfigString(in string) (map[string]string, error) {
 	fields := strings.Fields(in)
 	kvs := map[string]string{}
 	for _, field := range fields {
-		kv := strings.Split(field, "=")
+		kv := strings.SplitN(field, "=", 2)
 		if len(kv) != 2 {
 			return nil, fmt.Errorf("invalid key=value in kv config string: %s", field)
 		}
@@ -1,10 +1,15 @@
 package operator
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/streamingfast/shutter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
 )
 
 func TestParseKVConfigString(t *testing.T) {
@@ -56,6 +61,12 @@ func TestParseKVConfigString(t *testing.T) {
 			map[string]string{"type": "blah", "store": "", "freq": ""},
 			false,
 		},
+		{
+			"value with equal sign",
+			"type=tarball store=s3://bucket/path?region=us-east-1",
+			map[string]string{"type": "tarball", "store": "s3://bucket/path?region=us-east-1"},
+			false,
+		},
 	}
 
 	for _, tc := range cases {
@@ -71,3 +82,178 @@ func TestParseKVConfigString(t *testing.T) {
 		})
 	}
 }
+
+type testListableBackupModule struct {
+	backups []*BackupInfo
+}
+
+func (m *testListableBackupModule) Backup(_ uint32) (string, error)     { return "", nil }
+func (m *testListableBackupModule) RequiresStop() bool                  { return false }
+func (m *testListableBackupModule) ListBackups() ([]*BackupInfo, error) { return m.backups, nil }
+
+func TestListBackups(t *testing.T) {
+	mods := map[string]BackupModule{
+		"a": &testListableBackupModule{backups: []*BackupInfo{{Name: "a-10", BlockNum: 10}, {Name: "a-30", BlockNum: 30}}},
+		"b": &testListableBackupModule{backups: []*BackupInfo{{Name: "b-20", BlockNum: 20}}},
+	}
+
+	names := func(listing *BackupListing) (out []string) {
+		for _, b := range listing.Backups {
+			out = append(out, b.Module+"/"+b.Name)
+		}
+		return
+	}
+
+	listing, err := listBackups(mods, "", 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 3, listing.Total)
+	assert.Equal(t, []string{"a/a-30", "b/b-20", "a/a-10"}, names(listing))
+
+	listing, err = listBackups(mods, "", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b/b-20"}, names(listing))
+
+	listing, err = listBackups(mods, "", 5, 1)
+	require.NoError(t, err)
+	assert.Len(t, listing.Backups, 0)
+
+	listing, err = listBackups(mods, "a", 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/a-30", "a/a-10"}, names(listing))
+
+	_, err = listBackups(mods, "c", 0, 100)
+	require.Error(t, err)
+}
+
+type testDescribableBackupModule struct {
+	testListableBackupModule
+	described []string
+}
+
+func (m *testDescribableBackupModule) ListBackupNames() ([]*BackupInfo, error) {
+	var backups []*BackupInfo
+	for _, backup := range m.backups {
+		backups = append(backups, &BackupInfo{Name: backup.Name, BlockNum: backup.BlockNum})
+	}
+	return backups, nil
+}
+
+func (m *testDescribableBackupModule) DescribeBackup(backup *BackupInfo) error {
+	m.described = append(m.described, backup.Name)
+	backup.Size = int64(backup.BlockNum)
+	return nil
+}
+
+func TestListBackups_DescribesReturnedPageOnly(t *testing.T) {
+	mod := &testDescribableBackupModule{testListableBackupModule: testListableBackupModule{backups: []*BackupInfo{{Name: "10", BlockNum: 10}, {Name: "30", BlockNum: 30}, {Name: "20", BlockNum: 20}}}}
+
+	listing, err := listBackups(map[string]BackupModule{"a": mod}, "", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, listing.Total)
+	require.Len(t, listing.Backups, 1)
+	assert.Equal(t, "20", listing.Backups[0].Name)
+	assert.Equal(t, int64(20), listing.Backups[0].Size)
+	assert.Equal(t, []string{"20"}, mod.described)
+}
+
+func TestSelectBackup(t *testing.T) {
+	now := time.Now()
+	backups := []*BackupInfo{
+		{Name: "100", BlockNum: 100, Tags: []string{"v1"}},
+		{Name: "200", BlockNum: 200, Tags: []string{"v1", "pre-upgrade"}},
+		{Name: "300-old", BlockNum: 300, Timestamp: now.Add(-time.Hour)},
+		{Name: "300", BlockNum: 300, Timestamp: now, Tags: []string{"v2"}},
+	}
+
+	blockNum := func(num uint64) *uint64 { return &num }
+	name := func(b *BackupInfo) string {
+		if b == nil {
+			return ""
+		}
+		return b.Name
+	}
+
+	assert.Equal(t, "300", name(selectBackup(backups, nil, "")))
+	assert.Equal(t, "200", name(selectBackup(backups, blockNum(299), "")))
+	assert.Equal(t, "300", name(selectBackup(backups, blockNum(300), "")))
+	assert.Equal(t, "", name(selectBackup(backups, blockNum(99), "")))
+	assert.Equal(t, "200", name(selectBackup(backups, nil, "v1")))
+	assert.Equal(t, "100", name(selectBackup(backups, blockNum(150), "v1")))
+	assert.Equal(t, "", name(selectBackup(backups, blockNum(250), "v2")))
+}
+
+func TestResolveRestoreBackupName(t *testing.T) {
+	mod := &testRestorableBackupModule{testListableBackupModule{backups: []*BackupInfo{
+		{Name: "100", BlockNum: 100},
+		{Name: "200", BlockNum: 200},
+	}}}
+
+	cases := []struct {
+		name        string
+		params      map[string]string
+		expected    string
+		expectError bool
+	}{
+		{"default", map[string]string{}, "latest", false},
+		{"by name", map[string]string{"backupName": "foo"}, "foo", false},
+		{"by block", map[string]string{"blockNum": "150"}, "100", false},
+		{"no match", map[string]string{"blockNum": "50"}, "", true},
+		{"invalid block", map[string]string{"blockNum": "abc"}, "", true},
+		{"name and block", map[string]string{"backupName": "foo", "blockNum": "150"}, "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := resolveRestoreBackupName(mod, tc.params)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, out)
+		})
+	}
+}
+
+type testRestorableBackupModule struct {
+	testListableBackupModule
+}
+
+func (m *testRestorableBackupModule) Restore(_ string) error { return nil }
+
+type testVerifiableBackupModule struct {
+	testRestorableBackupModule
+	verified []string
+}
+
+func (m *testVerifiableBackupModule) Verify(_ context.Context, name string) error {
+	m.verified = append(m.verified, name)
+	return nil
+}
+
+func TestOperator_RestoreVerifiesOnlyWhenForced(t *testing.T) {
+	module := &testVerifiableBackupModule{}
+	o := &Operator{
+		Shutter:        shutter.New(),
+		options:        &Options{},
+		Superviser:     &testSuperviser{running: true},
+		commandHistory: newCommandHistory(10),
+		aboutToStop:    atomic.NewBool(false),
+		expectRunning:  atomic.NewBool(true),
+		zlogger:        zap.NewNop(),
+	}
+	require.NoError(t, o.RegisterBackupModule("test", module))
+
+	cmd := o.newCommand("restore", map[string]string{"backupName": "0000000010"})
+	require.NoError(t, o.runCommand(cmd))
+	cmd.Return(nil)
+	require.NoError(t, cmd.Err())
+	assert.Empty(t, module.verified)
+
+	cmd = o.newCommand("restore", map[string]string{"backupName": "0000000010", "forceVerify": "true"})
+	require.NoError(t, o.runCommand(cmd))
+	cmd.Return(nil)
+	require.NoError(t, cmd.Err())
+	assert.Equal(t, []string{"0000000010"}, module.verified)
+}
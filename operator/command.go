@@ -0,0 +1,397 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const defaultCommandHistorySize = 100
+
+type CommandState string
+
+const (
+	CommandStateQueued    CommandState = "queued"
+	CommandStateRunning   CommandState = "running"
+	CommandStateSucceeded CommandState = "succeeded"
+	CommandStateFailed    CommandState = "failed"
+)
+
+type Command struct {
+	id     string
+	cmd    string
+	params map[string]string
+	done   chan struct{}
+	closer sync.Once
+	logger *zap.Logger
+
+	// scheduled is set on commands issued by a schedule rather than by an operator
+	scheduled bool
+
+	// parent is set on sub-commands (e.g. the `start` issued after a `restore`), their
+	// outcome is reported through the parent command.
+	parent *Command
+
+	// ctx is canceled through `Cancel`, when the command completes or when `timeout`
+	// elapses once the command started running. Sub-commands share the context of
+	// their parent.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+
+	stateLock   sync.RWMutex
+	state       CommandState
+	createdAt   time.Time
+	startedAt   time.Time
+	completedAt time.Time
+	err         error
+	result      interface{}
+}
+
+// CommandStatus is the JSON representation of a command, as returned by the
+// `/v1/commands` endpoints.
+type CommandStatus struct {
+	ID          string            `json:"id"`
+	Command     string            `json:"command"`
+	Params      map[string]string `json:"params,omitempty"`
+	Scheduled   bool              `json:"scheduled,omitempty"`
+	State       CommandState      `json:"state"`
+	CreatedAt   time.Time         `json:"created_at"`
+	StartedAt   *time.Time        `json:"started_at,omitempty"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Result      interface{}       `json:"result,omitempty"`
+}
+
+func newCommandID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand never fails on supported platforms, fallback on time so we still get something unique enough
+		return hex.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano)))
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// newCommand creates a command with a unique ID and records it in the
+// command history so its outcome can be queried later on.
+func (o *Operator) newCommand(name string, params map[string]string) *Command {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Command{
+		id:        newCommandID(),
+		cmd:       name,
+		params:    params,
+		logger:    o.zlogger,
+		done:      make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		timeout:   o.options.CommandTimeouts[name],
+		state:     CommandStateQueued,
+		createdAt: time.Now(),
+	}
+
+	o.commandHistory.add(c)
+	return c
+}
+
+func (o *Operator) newScheduledCommand(name string, params map[string]string) *Command {
+	c := o.newCommand(name, params)
+	c.scheduled = true
+
+	return c
+}
+
+func (c *Command) ID() string {
+	return c.id
+}
+
+func (c *Command) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	if c.id != "" {
+		encoder.AddString("id", c.id)
+	}
+	encoder.AddString("name", c.cmd)
+	encoder.AddReflected("params", c.params)
+	return nil
+}
+
+func (c *Command) markRunning() {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if c.state == CommandStateQueued {
+		c.state = CommandStateRunning
+		c.startedAt = time.Now()
+
+		if c.timeout > 0 && c.ctx != nil {
+			ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+			parentCancel := c.cancel
+			c.ctx = ctx
+			c.cancel = func() {
+				cancel()
+				parentCancel()
+			}
+		}
+	}
+}
+
+// Done is closed once the command completed, `Err` then returns its outcome
+func (c *Command) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Command) Err() error {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+
+	return c.err
+}
+
+// sameAs reports if `other` would perform the same work as the command
+func (c *Command) sameAs(other *Command) bool {
+	if c.cmd != other.cmd || c.scheduled != other.scheduled || len(c.params) != len(other.params) {
+		return false
+	}
+
+	for key, value := range c.params {
+		if otherValue, found := other.params[key]; !found || otherValue != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Command) completed() bool {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+
+	return c.state == CommandStateSucceeded || c.state == CommandStateFailed
+}
+
+// Context is canceled when the command is canceled, times out or completes
+func (c *Command) Context() context.Context {
+	if c.parent != nil {
+		return c.parent.Context()
+	}
+
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Cancel aborts the command, a queued command is dropped when dequeued and a
+// running command is aborted if the operation it performs supports it. It
+// returns false when the command already completed.
+func (c *Command) Cancel() bool {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+
+	if c.state == CommandStateSucceeded || c.state == CommandStateFailed || c.cancel == nil {
+		return false
+	}
+
+	c.logger.Info("canceling command", zap.Object("command", c))
+	c.cancel()
+	return true
+}
+
+// contextError describes why the context of the command is done, nil when it is not
+func (c *Command) contextError() error {
+	if c.parent != nil {
+		return c.parent.contextError()
+	}
+
+	ctx := c.Context()
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return fmt.Errorf("command %s timed out after %s: %w", c.cmd, c.timeout, ctx.Err())
+	default:
+		return fmt.Errorf("command %s canceled: %w", c.cmd, ctx.Err())
+	}
+}
+
+func (c *Command) markCompleted(err error) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	c.completedAt = time.Now()
+	c.err = err
+	if err != nil && err != ErrCleanExit {
+		c.state = CommandStateFailed
+	} else {
+		c.state = CommandStateSucceeded
+	}
+}
+
+// setResult attaches the outcome of a command producing data (like `list`), it is
+// reported through the parent command for sub-commands.
+func (c *Command) setResult(result interface{}) {
+	if c.parent != nil {
+		c.parent.setResult(result)
+		return
+	}
+
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	c.result = result
+}
+
+func (c *Command) Result() interface{} {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+
+	return c.result
+}
+
+func (c *Command) Status() *CommandStatus {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+
+	status := &CommandStatus{
+		ID:        c.id,
+		Command:   c.cmd,
+		Params:    c.params,
+		Scheduled: c.scheduled,
+		State:     c.state,
+		CreatedAt: c.createdAt,
+		Result:    c.result,
+	}
+
+	if !c.startedAt.IsZero() {
+		startedAt := c.startedAt
+		status.StartedAt = &startedAt
+	}
+
+	if !c.completedAt.IsZero() {
+		completedAt := c.completedAt
+		status.CompletedAt = &completedAt
+	}
+
+	if c.err != nil && c.err != ErrCleanExit {
+		status.Error = c.err.Error()
+	}
+
+	return status
+}
+
+func (c *Command) Return(err error) {
+	if c.parent != nil {
+		c.parent.Return(err)
+		return
+	}
+
+	c.closer.Do(func() {
+		c.markCompleted(err)
+		if c.cancel != nil {
+			c.cancel()
+		}
+
+		if err != nil && err != ErrCleanExit {
+			c.logger.Error("command failed", zap.String("cmd", c.cmd), zap.Error(err))
+		}
+
+		if c.done != nil {
+			close(c.done)
+		}
+	})
+}
+
+// commandHistory keeps the last `maxSize` commands that were submitted to the
+// operator, oldest commands are evicted first.
+type commandHistory struct {
+	lock     sync.RWMutex
+	maxSize  int
+	commands []*Command
+	byID     map[string]*Command
+}
+
+func newCommandHistory(maxSize int) *commandHistory {
+	if maxSize <= 0 {
+		maxSize = defaultCommandHistorySize
+	}
+
+	return &commandHistory{
+		maxSize: maxSize,
+		byID:    make(map[string]*Command),
+	}
+}
+
+func (h *commandHistory) add(c *Command) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.commands = append(h.commands, c)
+	h.byID[c.id] = c
+
+	if len(h.commands) > h.maxSize {
+		evicted := h.commands[0]
+		delete(h.byID, evicted.id)
+
+		h.commands[0] = nil
+		h.commands = h.commands[1:]
+	}
+}
+
+func (h *commandHistory) remove(id string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, found := h.byID[id]; !found {
+		return
+	}
+	delete(h.byID, id)
+
+	for i, c := range h.commands {
+		if c.id == id {
+			h.commands = append(h.commands[:i], h.commands[i+1:]...)
+			break
+		}
+	}
+}
+
+func (h *commandHistory) get(id string) *Command {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.byID[id]
+}
+
+// list returns the commands from the most recent to the oldest one
+func (h *commandHistory) list() []*Command {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	out := make([]*Command, len(h.commands))
+	for i, c := range h.commands {
+		out[len(h.commands)-1-i] = c
+	}
+
+	return out
+}
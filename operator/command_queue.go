@@ -0,0 +1,167 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"errors"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const defaultCommandQueueSize = 10
+
+var ErrCommandQueueFull = errors.New("command queue is full")
+
+// commandQueue holds the commands waiting for the operator. Commands issued by an
+// operator are run before scheduled ones, and a command identical to one already
+// pending is not queued twice.
+type commandQueue struct {
+	lock     sync.Mutex
+	maxSize  int
+	commands []*Command
+
+	// notify holds a value as long as the queue is not empty
+	notify chan struct{}
+}
+
+func newCommandQueue(maxSize int) *commandQueue {
+	if maxSize <= 0 {
+		maxSize = defaultCommandQueueSize
+	}
+
+	return &commandQueue{
+		maxSize: maxSize,
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// push queues `c`, it returns the pending command identical to `c` when there is
+// one, in which case `c` is not queued, or `ErrCommandQueueFull`. Pending commands
+// canceled or timed out while queued are never returned, they are dropped when popped.
+func (q *commandQueue) push(c *Command) (pending *Command, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, queued := range q.commands {
+		if queued.sameAs(c) && queued.contextError() == nil {
+			return queued, nil
+		}
+	}
+
+	if len(q.commands) >= q.maxSize {
+		return nil, ErrCommandQueueFull
+	}
+
+	position := len(q.commands)
+	if !c.scheduled {
+		for i, queued := range q.commands {
+			if queued.scheduled {
+				position = i
+				break
+			}
+		}
+	}
+
+	q.commands = append(q.commands, nil)
+	copy(q.commands[position+1:], q.commands[position:])
+	q.commands[position] = c
+
+	q.signal()
+	return c, nil
+}
+
+// pop returns the next command to run, nil when the queue is empty
+func (q *commandQueue) pop() *Command {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.commands) == 0 {
+		return nil
+	}
+
+	c := q.commands[0]
+	q.commands[0] = nil
+	q.commands = q.commands[1:]
+
+	if len(q.commands) > 0 {
+		q.signal()
+	}
+
+	return c
+}
+
+// drain empties the queue and returns the commands it held
+func (q *commandQueue) drain() []*Command {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	drained := q.commands
+	q.commands = nil
+
+	select {
+	case <-q.notify:
+	default:
+	}
+
+	return drained
+}
+
+func (q *commandQueue) list() []*Command {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	out := make([]*Command, len(q.commands))
+	copy(out, q.commands)
+	return out
+}
+
+// ready receives a value when commands are waiting in the queue
+func (q *commandQueue) ready() <-chan struct{} {
+	return q.notify
+}
+
+func (q *commandQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue queues `c`, it returns the command that will actually run, which is
+// an identical command already pending when there is one.
+func (o *Operator) enqueue(c *Command) (*Command, error) {
+	queued, err := o.commandQueue.push(c)
+	if err != nil {
+		o.zlogger.Warn("rejecting command, queue is full", zap.Object("command", c))
+		o.commandHistory.remove(c.id)
+		return nil, err
+	}
+
+	if queued != c {
+		o.zlogger.Info("identical command already pending, not queuing it twice", zap.Object("command", c), zap.String("pending_id", queued.id))
+		o.commandHistory.remove(c.id)
+	}
+
+	return queued, nil
+}
+
+// enqueueScheduled queues a command issued by a schedule, it is dropped when the
+// queue is full, the schedule retries on its next run.
+func (o *Operator) enqueueScheduled(name string, params map[string]string) {
+	if _, err := o.enqueue(o.newScheduledCommand(name, params)); err != nil {
+		o.zlogger.Warn("dropping scheduled command", zap.String("command", name), zap.Reflect("params", params), zap.Error(err))
+	}
+}
@@ -0,0 +1,63 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCommandQueue(t *testing.T) {
+	queue := newCommandQueue(3)
+
+	scheduled := &Command{id: "1", cmd: "backup", params: map[string]string{"name": "a"}, scheduled: true}
+	queued, err := queue.push(scheduled)
+	require.NoError(t, err)
+	assert.Equal(t, scheduled, queued)
+
+	queued, err = queue.push(&Command{id: "2", cmd: "backup", params: map[string]string{"name": "a"}, scheduled: true})
+	require.NoError(t, err)
+	assert.Equal(t, scheduled, queued, "identical pending command is not queued twice")
+
+	maintenance := &Command{id: "3", cmd: "maintenance"}
+	_, err = queue.push(maintenance)
+	require.NoError(t, err)
+
+	backup := &Command{id: "4", cmd: "backup", params: map[string]string{"name": "b"}}
+	_, err = queue.push(backup)
+	require.NoError(t, err)
+
+	_, err = queue.push(&Command{id: "5", cmd: "resume"})
+	assert.Equal(t, ErrCommandQueueFull, err)
+
+	assert.Equal(t, []*Command{maintenance, backup, scheduled}, queue.list(), "operator commands run before scheduled ones")
+
+	<-queue.ready()
+	assert.Equal(t, maintenance, queue.pop())
+	<-queue.ready()
+	assert.Equal(t, []*Command{backup, scheduled}, queue.drain())
+
+	select {
+	case <-queue.ready():
+		t.Fatal("queue should not be ready once drained")
+	default:
+	}
+	assert.Nil(t, queue.pop())
+}
+
+func TestCommandQueue_SkipsCanceledPendingCommand(t *testing.T) {
+	o := &Operator{options: &Options{}, commandHistory: newCommandHistory(10), zlogger: zap.NewNop()}
+	queue := newCommandQueue(3)
+
+	canceled := o.newCommand("backup", map[string]string{"name": "a"})
+	_, err := queue.push(canceled)
+	require.NoError(t, err)
+	require.True(t, canceled.Cancel())
+
+	fresh := o.newCommand("backup", map[string]string{"name": "a"})
+	queued, err := queue.push(fresh)
+	require.NoError(t, err)
+	assert.Equal(t, fresh, queued, "canceled pending command is not reused")
+	assert.Equal(t, []*Command{canceled, fresh}, queue.list())
+}
@@ -0,0 +1,74 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCommandHistory(t *testing.T) {
+	history := newCommandHistory(3)
+
+	var commands []*Command
+	for i := 0; i < 5; i++ {
+		c := &Command{id: fmt.Sprintf("cmd-%d", i), cmd: "backup"}
+		commands = append(commands, c)
+		history.add(c)
+	}
+
+	assert.Nil(t, history.get("cmd-0"))
+	assert.Nil(t, history.get("cmd-1"))
+	assert.Equal(t, commands[2], history.get("cmd-2"))
+	assert.Equal(t, []*Command{commands[4], commands[3], commands[2]}, history.list())
+}
+
+func TestCommandStatus(t *testing.T) {
+	c := &Command{id: "abc", cmd: "restore", state: CommandStateQueued, logger: zap.NewNop()}
+	assert.Equal(t, CommandStateQueued, c.Status().State)
+	assert.Nil(t, c.Status().StartedAt)
+
+	c.markRunning()
+	require.NotNil(t, c.Status().StartedAt)
+	assert.Equal(t, CommandStateRunning, c.Status().State)
+
+	c.Return(fmt.Errorf("boom"))
+	status := c.Status()
+	assert.Equal(t, CommandStateFailed, status.State)
+	assert.Equal(t, "boom", status.Error)
+	assert.NotNil(t, status.CompletedAt)
+
+	sub := &Command{cmd: "start", parent: c, logger: zap.NewNop()}
+	sub.Return(nil)
+	assert.Equal(t, CommandStateFailed, c.Status().State, "parent already returned, should not be overridden")
+
+	c2 := &Command{id: "def", cmd: "restore", state: CommandStateQueued, logger: zap.NewNop()}
+	sub = &Command{cmd: "start", parent: c2, logger: zap.NewNop()}
+	sub.Return(nil)
+	assert.Equal(t, CommandStateSucceeded, c2.Status().State)
+}
+
+func TestCommandCancel(t *testing.T) {
+	o := &Operator{zlogger: zap.NewNop(), options: &Options{CommandTimeouts: map[string]time.Duration{"backup": time.Millisecond}}, commandHistory: newCommandHistory(0)}
+
+	c := o.newCommand("restore", nil)
+	assert.NoError(t, c.contextError())
+	assert.True(t, c.Cancel())
+	assert.ErrorIs(t, c.contextError(), context.Canceled)
+
+	sub := &Command{cmd: "start", parent: c, logger: zap.NewNop()}
+	assert.ErrorIs(t, sub.contextError(), context.Canceled, "sub-commands share the context of their parent")
+
+	c.Return(c.contextError())
+	assert.False(t, c.Cancel(), "completed commands cannot be canceled")
+
+	timed := o.newCommand("backup", nil)
+	timed.markRunning()
+	<-timed.Context().Done()
+	assert.ErrorIs(t, timed.contextError(), context.DeadlineExceeded)
+	assert.Contains(t, timed.contextError().Error(), "timed out after 1ms")
+}
@@ -0,0 +1,221 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// CronSchedule is a standard 5 fields cron expression (minute, hour, day of month,
+// month, day of week) evaluated against the wall clock of the time it is given.
+// Fields accept `*`, single values, ranges (`1-5`), steps (`*/15`, `0-30/10`) and
+// comma separated lists of those. The `@hourly`, `@daily`, `@weekly`, `@monthly` and
+// `@yearly` macros are also accepted.
+type CronSchedule struct {
+	expression string
+
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+
+	// When both day fields are restricted, a day matches if either of them matches
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+// ParseCronSchedule parses `expression`, fields can be separated by spaces or by
+// underscores (`0_3_*_*_*`) so the expression can be used in a kv config string.
+func ParseCronSchedule(expression string) (*CronSchedule, error) {
+	normalized := strings.TrimSpace(strings.ReplaceAll(expression, "_", " "))
+	if macro, found := cronMacros[normalized]; found {
+		normalized = macro
+	}
+
+	fields := strings.Fields(normalized)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q, expected %d fields, got %d", expression, len(cronFields), len(fields))
+	}
+
+	schedule := &CronSchedule{
+		expression:    expression,
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}
+
+	for i, target := range []*uint64{&schedule.minutes, &schedule.hours, &schedule.daysOfMonth, &schedule.months, &schedule.daysOfWeek} {
+		bits, err := parseCronField(fields[i], cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expression, err)
+		}
+		*target = bits
+	}
+
+	// Sunday can be written as 0 or 7
+	if schedule.daysOfWeek&(1<<7) != 0 {
+		schedule.daysOfWeek = schedule.daysOfWeek&^(1<<7) | 1
+	}
+
+	return schedule, nil
+}
+
+func parseCronField(in string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(in, ",") {
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx != -1 {
+			value, err := strconv.Atoi(part[idx+1:])
+			if err != nil || value <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", part[idx+1:], field.name)
+			}
+			rangePart, step = part[:idx], value
+		}
+
+		low, high := field.min, field.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = parseCronValue(bounds[0], field); err != nil {
+				return 0, err
+			}
+			if high, err = parseCronValue(bounds[1], field); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangePart, field.name)
+			}
+		default:
+			value, err := parseCronValue(rangePart, field)
+			if err != nil {
+				return 0, err
+			}
+
+			// A single value with a step (`5/15`) runs from that value to the end of the range
+			low = value
+			if step == 1 {
+				high = value
+			}
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(in string, field cronField) (int, error) {
+	value, err := strconv.Atoi(in)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", in, field.name)
+	}
+
+	if value < field.min || value > field.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d] in %s field", value, field.min, field.max, field.name)
+	}
+
+	return value, nil
+}
+
+func (s *CronSchedule) String() string {
+	return s.expression
+}
+
+// Next returns the first time strictly after `t` matching the schedule, in the
+// location of `t`. It returns the zero time if nothing matches within 5 years
+// (e.g. `0 0 31 2 *`).
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// forward returns `candidate` unless it is not after `t`, which happens when the
+// candidate wall clock time is skipped by a daylight saving time change and gets
+// normalized to a time before the change.
+func forward(t, candidate time.Time) time.Time {
+	if candidate.After(t) {
+		return candidate
+	}
+
+	return candidate.Add(time.Hour)
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.daysOfMonth&(1<<uint(t.Day())) != 0
+	dowMatch := s.daysOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
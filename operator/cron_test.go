@@ -0,0 +1,124 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		expression  string
+		expectError bool
+	}{
+		{"0 3 * * *", false},
+		{"0_3_*_*_*", false},
+		{"*/15 * * * 1-5", false},
+		{"0,30 8-18/2 1 1,6 7", false},
+		{"@daily", false},
+		{"0 3 * *", true},
+		{"60 * * * *", true},
+		{"* * 0 * *", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"a * * * *", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			_, err := ParseCronSchedule(test.expression)
+			if test.expectError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewCronBackupSchedule(t *testing.T) {
+	sched, err := NewCronBackupSchedule("0_3_*_*_*", "host-1", "tarball")
+	require.NoError(t, err)
+	require.NotNil(t, sched.Cron)
+	assert.Equal(t, "host-1", sched.RequiredHostnameMatch)
+	assert.Equal(t, "tarball", sched.BackuperName)
+
+	_, err = NewCronBackupSchedule("0 3 * *", "", "tarball")
+	require.Error(t, err)
+
+	factories := map[string]BackupModuleFactory{"tarball": TarballBackupModuleFactory}
+	_, scheds, err := ParseBackupConfigs(zap.NewNop(), []string{"type=tarball store=file://" + t.TempDir() + " path=/tmp/data freq-cron=@daily"}, factories)
+	require.NoError(t, err)
+	require.Len(t, scheds, 1)
+	assert.NotNil(t, scheds[0].Cron)
+
+	for _, freq := range []string{"freq-time=1h", "freq-blocks=1000"} {
+		_, _, err = ParseBackupConfigs(zap.NewNop(), []string{"type=tarball store=file://" + t.TempDir() + " path=/tmp/data freq-cron=@daily " + freq}, factories)
+		assert.Error(t, err, freq)
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	at := func(value string) time.Time {
+		out, err := time.Parse("2006-01-02 15:04", value)
+		require.NoError(t, err)
+		return out
+	}
+
+	tests := []struct {
+		expression string
+		from       string
+		expected   string
+	}{
+		{"0 3 * * *", "2022-11-14 02:59", "2022-11-14 03:00"},
+		{"0 3 * * *", "2022-11-14 03:00", "2022-11-15 03:00"},
+		{"*/15 * * * *", "2022-11-14 10:07", "2022-11-14 10:15"},
+		{"30 23 31 12 *", "2022-11-14 10:07", "2022-12-31 23:30"},
+		{"0 0 1 * *", "2022-12-31 23:30", "2023-01-01 00:00"},
+		{"0 9 * * 1-5", "2022-11-18 10:00", "2022-11-21 09:00"}, // Friday to Monday
+		{"0 9 * * 7", "2022-11-18 10:00", "2022-11-20 09:00"},   // Sunday as 7
+		{"0 0 13 * 5", "2022-11-14 10:00", "2022-11-18 00:00"},  // day of month or Friday
+		{"0 0 29 2 *", "2022-11-14 10:00", "2024-02-29 00:00"},
+		{"@hourly", "2022-11-14 10:07", "2022-11-14 11:00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression+" from "+test.from, func(t *testing.T) {
+			schedule, err := ParseCronSchedule(test.expression)
+			require.NoError(t, err)
+
+			assert.Equal(t, at(test.expected), schedule.Next(at(test.from)))
+		})
+	}
+
+	never, err := ParseCronSchedule("0 0 31 2 *")
+	require.NoError(t, err)
+	assert.True(t, never.Next(at("2022-11-14 10:00")).IsZero())
+}
+
+func TestOperator_MissedCronRun(t *testing.T) {
+	cron, err := ParseCronSchedule("0 3 * * *")
+	require.NoError(t, err)
+
+	now := time.Date(2022, 11, 14, 10, 0, 0, 0, time.UTC)
+	newOperator := func(backups ...*BackupInfo) *Operator {
+		return &Operator{
+			zlogger:       zap.NewNop(),
+			backupModules: map[string]BackupModule{"a": &testListableBackupModule{backups: backups}},
+		}
+	}
+	sched := &launchedSchedule{BackupSchedule: &BackupSchedule{BackuperName: "a", Cron: cron}}
+
+	missed, _ := newOperator().missedCronRun(sched, now)
+	assert.False(t, missed, "no backup yet")
+
+	missed, _ = newOperator(&BackupInfo{Name: "1", Timestamp: now.Add(-30 * time.Hour)}, &BackupInfo{Name: "2", Timestamp: now.Add(-6 * time.Hour)}).missedCronRun(sched, now)
+	assert.False(t, missed, "backup at 04:00 today, next run is tomorrow")
+
+	missed, latest := newOperator(&BackupInfo{Name: "1", Timestamp: now.Add(-30 * time.Hour)}).missedCronRun(sched, now)
+	assert.True(t, missed, "backup at 04:00 yesterday, run at 03:00 today was missed")
+	assert.Equal(t, now.Add(-30*time.Hour), latest)
+}
@@ -14,6 +14,45 @@
 
 package operator
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 var ErrCleanExit = errors.New("clean exit")
+
+// ProcessStoppedError is the error the operator shuts down with when the supervised
+// process stopped on its own and was neither recovered nor restarted. Use `errors.As`
+// to retrieve it from the error returned by `Operator.Launch` or `Operator.Err`.
+type ProcessStoppedError struct {
+	Instance string
+	ExitCode int
+
+	// PID, Signal and Runtime are only filled when the superviser implements
+	// `nodeManager.ExitStatusChainSuperviser`.
+	PID     int
+	Signal  string
+	Runtime time.Duration
+
+	LastLogLines []string
+}
+
+func (e *ProcessStoppedError) Error() string {
+	var details []string
+	details = append(details, fmt.Sprintf("exit code: %d", e.ExitCode))
+	if e.Signal != "" {
+		details = append(details, fmt.Sprintf("signal: %s", e.Signal))
+	}
+	if e.Runtime > 0 {
+		details = append(details, fmt.Sprintf("runtime: %s", e.Runtime))
+	}
+
+	msg := fmt.Sprintf("instance %q stopped (%s), shutting down", e.Instance, strings.Join(details, ", "))
+	if len(e.LastLogLines) > 0 {
+		msg += ": last log lines:\n" + formatLogLines(e.LastLogLines)
+	}
+
+	return msg
+}
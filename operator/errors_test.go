@@ -0,0 +1,29 @@
+package operator
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessStoppedError(t *testing.T) {
+	var err error = &ProcessStoppedError{
+		Instance:     "geth",
+		ExitCode:     -1,
+		Signal:       "killed",
+		Runtime:      90 * time.Second,
+		LastLogLines: []string{"a", "b"},
+	}
+
+	assert.Equal(t, "instance \"geth\" stopped (exit code: -1, signal: killed, runtime: 1m30s), shutting down: last log lines:\n  a\n  b", err.Error())
+
+	var stoppedErr *ProcessStoppedError
+	require.True(t, errors.As(fmt.Errorf("wrapped: %w", err), &stoppedErr))
+	assert.Equal(t, -1, stoppedErr.ExitCode)
+
+	assert.Equal(t, "instance \"geth\" stopped (exit code: 1), shutting down", (&ProcessStoppedError{Instance: "geth", ExitCode: 1}).Error())
+}
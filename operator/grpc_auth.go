@@ -0,0 +1,178 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	pbnodemanager "github.com/streamingfast/node-manager/pb/sf/node_manager/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var nodeManagerMethodPrefix = "/" + pbnodemanager.NodeManager_ServiceDesc.ServiceName + "/"
+
+// nodeManagerReadOnlyMethods do not change the node state, they are not audited. Like
+// the routes of the HTTP server, they require the role they map to unless
+// `AuthConfig.RouteRoles` says otherwise.
+var nodeManagerReadOnlyMethods = map[string]Role{
+	"ListBackups": RoleReader,
+	"Status":      RoleNone,
+	"StreamLogs":  RoleReader,
+}
+
+// grpcAuthorizedKey marks the context of calls authorized by the interceptors
+type grpcAuthorizedKey struct{}
+
+// UnaryInterceptor authenticates the callers of the NodeManager service and enforces
+// the role required by each RPC, like `Operator.WithAuth` for the HTTP server. RPCs
+// requiring a role are rejected when the server has no `AuthConfig`. Calls to other
+// services are passed through.
+func (s *NodeManagerServer) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !strings.HasPrefix(info.FullMethod, nodeManagerMethodPrefix) {
+			return handler(ctx, req)
+		}
+
+		identity, err := s.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := handler(context.WithValue(ctx, grpcAuthorizedKey{}, true), req)
+		s.audit(ctx, info.FullMethod, identity, err)
+
+		return resp, err
+	}
+}
+
+// StreamInterceptor is the `UnaryInterceptor` of streaming RPCs.
+func (s *NodeManagerServer) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !strings.HasPrefix(info.FullMethod, nodeManagerMethodPrefix) {
+			return handler(srv, stream)
+		}
+
+		identity, err := s.authorize(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		err = handler(srv, stream)
+		s.audit(stream.Context(), info.FullMethod, identity, err)
+
+		return err
+	}
+}
+
+func (s *NodeManagerServer) requiredRole(fullMethod string) Role {
+	if s.auth != nil {
+		if role, found := s.auth.RouteRoles[fullMethod]; found {
+			return role
+		}
+	}
+
+	if role, found := nodeManagerReadOnlyMethods[strings.TrimPrefix(fullMethod, nodeManagerMethodPrefix)]; found {
+		return role
+	}
+
+	return RoleOperator
+}
+
+func (s *NodeManagerServer) authorize(ctx context.Context, fullMethod string) (*Identity, error) {
+	role := s.requiredRole(fullMethod)
+	if role == RoleNone {
+		return nil, nil
+	}
+
+	if s.auth == nil {
+		return nil, status.Errorf(codes.PermissionDenied, "%s requires authentication, which is not configured", fullMethod)
+	}
+
+	req := grpcAuthRequest(ctx)
+	identity, err := s.auth.authorize(req, role)
+	var roleErr *missingRoleError
+	switch {
+	case err == nil:
+		return identity, nil
+	case errors.As(err, &roleErr):
+		s.operator.zlogger.Info("rejecting call missing required role", zap.String("identity", identity.Name), zap.String("role", string(role)), zap.String("method", fullMethod))
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err == errAuthenticationRequired:
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	default:
+		s.operator.zlogger.Info("rejecting call with invalid credentials", zap.String("method", fullMethod), zap.String("remote_addr", req.RemoteAddr), zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, errInvalidCredentials.Error())
+	}
+}
+
+func (s *NodeManagerServer) audit(ctx context.Context, fullMethod string, identity *Identity, err error) {
+	if identity == nil {
+		return
+	}
+
+	if _, readOnly := nodeManagerReadOnlyMethods[strings.TrimPrefix(fullMethod, nodeManagerMethodPrefix)]; readOnly {
+		return
+	}
+
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	s.auditLogger.Info("authorized mutation",
+		zap.String("identity", identity.Name),
+		zap.String("auth_method", identity.Method),
+		zap.String("method", fullMethod),
+		zap.String("remote_addr", remoteAddr),
+		zap.String("code", status.Code(err).String()),
+	)
+}
+
+// grpcAuthRequest exposes the credentials of a gRPC call as an HTTP request, so the
+// `Authenticator`s of the HTTP server identify gRPC callers the same way
+func grpcAuthRequest(ctx context.Context) *http.Request {
+	req := &http.Request{Method: http.MethodPost, URL: &url.URL{}, Header: http.Header{}}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			req.Header.Add("Authorization", value)
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state := tlsInfo.State
+			req.TLS = &state
+		}
+	}
+
+	return req
+}
+
+// grpcAuthorized reports if the interceptors authorized the call of `ctx`
+func grpcAuthorized(ctx context.Context) bool {
+	authorized, _ := ctx.Value(grpcAuthorizedKey{}).(bool)
+	return authorized
+}
@@ -0,0 +1,314 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	logplugin "github.com/streamingfast/node-manager/log_plugin"
+	pbnodemanager "github.com/streamingfast/node-manager/pb/sf/node_manager/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// logStreamBufferSize is the amount of lines buffered for each `StreamLogs`
+// client, lines logged while a client buffer is full are not sent to it
+const logStreamBufferSize = 1000
+
+// NodeManagerServer implements the `sf.node_manager.v1.NodeManager` gRPC service
+// on top of the operator command queue.
+type NodeManagerServer struct {
+	pbnodemanager.UnimplementedNodeManagerServer
+
+	operator    *Operator
+	logs        *logplugin.BroadcastLogPlugin
+	auth        *AuthConfig
+	auditLogger *zap.Logger
+}
+
+// NewNodeManagerServer creates the gRPC service of `o`, protected by `auth` through
+// the server interceptors, see `UnaryInterceptor`. The process logs are streamed
+// once `LogPlugin` is registered on the superviser.
+func NewNodeManagerServer(o *Operator, auth *AuthConfig) *NodeManagerServer {
+	s := &NodeManagerServer{
+		operator:    o,
+		logs:        logplugin.NewBroadcastLogPlugin(),
+		auth:        auth,
+		auditLogger: o.zlogger.Named("audit"),
+	}
+
+	if auth != nil {
+		s.auditLogger = auth.auditLogger(o.zlogger)
+	}
+
+	return s
+}
+
+// LogPlugin broadcasts the process logs to the `StreamLogs` clients
+func (s *NodeManagerServer) LogPlugin() logplugin.LogPlugin {
+	return s.logs
+}
+
+func (s *NodeManagerServer) Start(ctx context.Context, req *pbnodemanager.StartRequest) (*pbnodemanager.CommandResponse, error) {
+	params := map[string]string{"debug-firehose-logs": strconv.FormatBool(req.DebugFirehoseLogs)}
+	return s.runCommand(ctx, "resume", params, req.Options)
+}
+
+func (s *NodeManagerServer) Maintenance(ctx context.Context, req *pbnodemanager.MaintenanceRequest) (*pbnodemanager.CommandResponse, error) {
+	return s.runCommand(ctx, "maintenance", nil, req.Options)
+}
+
+func (s *NodeManagerServer) Reload(ctx context.Context, req *pbnodemanager.ReloadRequest) (*pbnodemanager.CommandResponse, error) {
+	params, err := reloadRequestParams(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if req.Safely {
+		return s.runCommand(ctx, "safely_reload", params, req.Options)
+	}
+
+	return s.runCommand(ctx, "reload", params, req.Options)
+}
+
+// reloadRequestParams converts `req` to the parameters of a reload command, see `reloadRequest`
+func reloadRequestParams(req *pbnodemanager.ReloadRequest) (map[string]string, error) {
+	params := map[string]string{}
+	if req.ReloadConfig {
+		params["reload_config"] = "true"
+	}
+
+	if window := req.RollbackWindow; window != nil {
+		if err := window.CheckValid(); err != nil || window.AsDuration() < 0 {
+			return nil, fmt.Errorf("invalid rollback window %s, expecting a positive duration", window)
+		}
+		params["rollback_window"] = window.AsDuration().String()
+	}
+
+	if _, err := parseReloadRequest(params); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+func (s *NodeManagerServer) Backup(ctx context.Context, req *pbnodemanager.BackupRequest) (*pbnodemanager.CommandResponse, error) {
+	params := map[string]string{}
+	if req.BackuperName != "" {
+		params["name"] = req.BackuperName
+	}
+
+	return s.runCommand(ctx, "backup", params, req.Options)
+}
+
+func (s *NodeManagerServer) Restore(ctx context.Context, req *pbnodemanager.RestoreRequest) (*pbnodemanager.CommandResponse, error) {
+	params := map[string]string{}
+	if req.BackuperName != "" {
+		params["name"] = req.BackuperName
+	}
+	if req.BackupName != "" {
+		params["backupName"] = req.BackupName
+	}
+	if req.BackupTag != "" {
+		params["backupTag"] = req.BackupTag
+	}
+	if req.BlockNum != 0 {
+		params["blockNum"] = strconv.FormatUint(req.BlockNum, 10)
+	}
+	if req.ForceVerify {
+		params["forceVerify"] = "true"
+	}
+
+	return s.runCommand(ctx, "restore", params, req.Options)
+}
+
+func (s *NodeManagerServer) ListBackups(ctx context.Context, req *pbnodemanager.ListBackupsRequest) (*pbnodemanager.ListBackupsResponse, error) {
+	params := map[string]string{"offset": strconv.FormatUint(uint64(req.Offset), 10)}
+	if req.BackuperName != "" {
+		params["name"] = req.BackuperName
+	}
+	if req.Limit != 0 {
+		params["limit"] = strconv.FormatUint(uint64(req.Limit), 10)
+	}
+
+	c, err := s.operator.sendCommandAndWait(ctx, s.operator.newCommand("list", params))
+	if err != nil {
+		return nil, commandError("list", err)
+	}
+
+	listing, ok := c.Result().(*BackupListing)
+	if !ok {
+		return nil, status.Error(codes.Internal, "list command did not return a backup listing")
+	}
+
+	resp := &pbnodemanager.ListBackupsResponse{
+		Backups: make([]*pbnodemanager.BackupInfo, len(listing.Backups)),
+		Total:   uint32(listing.Total),
+		Offset:  uint32(listing.Offset),
+		Limit:   uint32(listing.Limit),
+	}
+
+	for i, backup := range listing.Backups {
+		resp.Backups[i] = &pbnodemanager.BackupInfo{
+			Module:    backup.Module,
+			Name:      backup.Name,
+			BlockNum:  backup.BlockNum,
+			Size:      backup.Size,
+			Timestamp: timestamppb.New(backup.Timestamp),
+			Tags:      backup.Tags,
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *NodeManagerServer) Status(_ context.Context, _ *pbnodemanager.StatusRequest) (*pbnodemanager.StatusResponse, error) {
+	reason := s.operator.notReadyReason()
+
+	return &pbnodemanager.StatusResponse{
+		Running:          s.operator.Superviser.IsRunning(),
+		Ready:            reason == "",
+		NotReadyReason:   reason,
+		LastSeenBlockNum: s.operator.Superviser.LastSeenBlockNum(),
+		PendingCommands:  uint32(len(s.operator.commandQueue.list())),
+	}, nil
+}
+
+func (s *NodeManagerServer) StreamLogs(req *pbnodemanager.StreamLogsRequest, stream pbnodemanager.NodeManager_StreamLogsServer) error {
+	// Subscribing before reading the tail so no line is missed in between
+	sub := s.logs.Subscribe(logStreamBufferSize)
+	defer func() {
+		if dropped := s.logs.Unsubscribe(sub); dropped > 0 {
+			s.operator.zlogger.Info("log stream client did not keep up, lines were not sent", zap.Uint64("dropped_lines", dropped))
+		}
+	}()
+
+	if req.Tail > 0 {
+		lines := s.operator.Superviser.LastLogLines()
+		if len(lines) > int(req.Tail) {
+			lines = lines[len(lines)-int(req.Tail):]
+		}
+
+		for _, line := range lines {
+			if err := stream.Send(&pbnodemanager.LogLine{Line: line}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.operator.Terminating():
+			return status.Error(codes.Unavailable, "node manager is shutting down")
+		case line := <-sub.Lines():
+			if err := stream.Send(&pbnodemanager.LogLine{Line: line}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// runCommand queues the command, waiting for its completion when requested. A
+// failed command is not a gRPC error, its state and error are in the response.
+func (s *NodeManagerServer) runCommand(ctx context.Context, name string, params map[string]string, options *pbnodemanager.CommandOptions) (*pbnodemanager.CommandResponse, error) {
+	// Fails closed when the service is registered without its interceptors
+	if !grpcAuthorized(ctx) {
+		return nil, status.Error(codes.PermissionDenied, "call not authorized, the server is missing the NodeManager interceptors")
+	}
+
+	if s.operator.stopping() {
+		return nil, status.Error(codes.Unavailable, "node is stopping, try again later")
+	}
+
+	c := s.operator.newCommand(name, params)
+	if timeout := options.GetTimeout(); timeout != nil {
+		if err := timeout.CheckValid(); err != nil || timeout.AsDuration() <= 0 {
+			s.operator.commandHistory.remove(c.id)
+			return nil, status.Errorf(codes.InvalidArgument, "invalid timeout %s, expecting a positive duration", timeout)
+		}
+		c.timeout = timeout.AsDuration()
+	}
+
+	if !options.GetWait() {
+		queued, err := s.operator.enqueue(c)
+		if err != nil {
+			return nil, commandError(name, err)
+		}
+
+		return &pbnodemanager.CommandResponse{Command: commandToProto(queued)}, nil
+	}
+
+	queued, err := s.operator.sendCommandAndWait(ctx, c)
+	if queued == nil || ctx.Err() != nil {
+		return nil, commandError(name, err)
+	}
+
+	return &pbnodemanager.CommandResponse{Command: commandToProto(queued)}, nil
+}
+
+func commandError(name string, err error) error {
+	switch {
+	case err == ErrCommandQueueFull:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case err == context.Canceled || err == context.DeadlineExceeded:
+		return status.FromContextError(err).Err()
+	default:
+		return status.Errorf(codes.Internal, "%s failed: %s", name, err)
+	}
+}
+
+var commandStateToProto = map[CommandState]pbnodemanager.CommandState{
+	CommandStateQueued:    pbnodemanager.CommandState_COMMAND_STATE_QUEUED,
+	CommandStateRunning:   pbnodemanager.CommandState_COMMAND_STATE_RUNNING,
+	CommandStateSucceeded: pbnodemanager.CommandState_COMMAND_STATE_SUCCEEDED,
+	CommandStateFailed:    pbnodemanager.CommandState_COMMAND_STATE_FAILED,
+}
+
+func commandToProto(c *Command) *pbnodemanager.Command {
+	cmdStatus := c.Status()
+
+	out := &pbnodemanager.Command{
+		Id:        cmdStatus.ID,
+		Name:      cmdStatus.Command,
+		Params:    cmdStatus.Params,
+		Scheduled: cmdStatus.Scheduled,
+		State:     commandStateToProto[cmdStatus.State],
+		CreatedAt: timestamppb.New(cmdStatus.CreatedAt),
+		Error:     cmdStatus.Error,
+	}
+
+	if cmdStatus.StartedAt != nil {
+		out.StartedAt = timestamppb.New(*cmdStatus.StartedAt)
+	}
+
+	if cmdStatus.CompletedAt != nil {
+		out.CompletedAt = timestamppb.New(*cmdStatus.CompletedAt)
+	}
+
+	if cmdStatus.Result != nil {
+		if result, err := json.Marshal(cmdStatus.Result); err == nil {
+			out.ResultJson = string(result)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,131 @@
+package operator
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	pbnodemanager "github.com/streamingfast/node-manager/pb/sf/node_manager/v1"
+	"github.com/streamingfast/shutter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestNodeManagerServer_RunCommand(t *testing.T) {
+	o := &Operator{
+		Shutter:        shutter.New(),
+		aboutToStop:    atomic.NewBool(false),
+		options:        &Options{},
+		commandQueue:   newCommandQueue(1),
+		commandHistory: newCommandHistory(10),
+		zlogger:        zap.NewNop(),
+	}
+	server := &NodeManagerServer{operator: o}
+	authorized := context.WithValue(context.Background(), grpcAuthorizedKey{}, true)
+
+	_, err := server.Maintenance(context.Background(), &pbnodemanager.MaintenanceRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "calls not going through the interceptors are rejected")
+
+	resp, err := server.Restore(authorized, &pbnodemanager.RestoreRequest{
+		Options:    &pbnodemanager.CommandOptions{Timeout: durationpb.New(time.Minute)},
+		BackupName: "0000000100",
+		BlockNum:   100,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "restore", resp.Command.Name)
+	assert.Equal(t, pbnodemanager.CommandState_COMMAND_STATE_QUEUED, resp.Command.State)
+	assert.Equal(t, map[string]string{"backupName": "0000000100", "blockNum": "100"}, resp.Command.Params)
+	assert.Equal(t, time.Minute, o.commandHistory.get(resp.Command.Id).timeout)
+
+	_, err = server.Maintenance(authorized, &pbnodemanager.MaintenanceRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = server.Backup(authorized, &pbnodemanager.BackupRequest{
+		Options: &pbnodemanager.CommandOptions{Timeout: durationpb.New(-time.Second)},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ctx, cancel := context.WithTimeout(authorized, 10*time.Millisecond)
+	defer cancel()
+
+	_, err = server.Restore(ctx, &pbnodemanager.RestoreRequest{
+		Options:    &pbnodemanager.CommandOptions{Wait: true},
+		BackupName: "0000000100",
+		BlockNum:   100,
+	})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err), "waiting on the identical pending command until the client gives up")
+
+	o.aboutToStop.Store(true)
+	_, err = server.Reload(authorized, &pbnodemanager.ReloadRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestNodeManagerServer_UnaryInterceptor(t *testing.T) {
+	tokens := &BearerTokenAuthenticator{identities: map[[sha256.Size]byte]*Identity{
+		sha256.Sum256([]byte("reader-token")):   {Name: "alice", Roles: []Role{RoleReader}, Method: "token"},
+		sha256.Sum256([]byte("operator-token")): {Name: "bob", Roles: []Role{RoleOperator}, Method: "token"},
+	}}
+	o := &Operator{zlogger: zap.NewNop()}
+
+	call := func(server *NodeManagerServer, method string, token string) (authorized bool, err error) {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+
+		handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+			authorized = grpcAuthorized(ctx)
+			return nil, nil
+		}
+
+		_, err = server.UnaryInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return
+	}
+
+	server := NewNodeManagerServer(o, &AuthConfig{Authenticators: []Authenticator{tokens}})
+	tests := []struct {
+		method   string
+		token    string
+		expected codes.Code
+	}{
+		{"/sf.node_manager.v1.NodeManager/Status", "", codes.OK},
+		{"/sf.node_manager.v1.NodeManager/Status", "wrong-token", codes.OK},
+		{"/sf.node_manager.v1.NodeManager/ListBackups", "", codes.Unauthenticated},
+		{"/sf.node_manager.v1.NodeManager/ListBackups", "reader-token", codes.OK},
+		{"/sf.node_manager.v1.NodeManager/StreamLogs", "", codes.Unauthenticated},
+		{"/sf.node_manager.v1.NodeManager/StreamLogs", "reader-token", codes.OK},
+		{"/sf.node_manager.v1.NodeManager/Maintenance", "", codes.Unauthenticated},
+		{"/sf.node_manager.v1.NodeManager/Maintenance", "wrong-token", codes.Unauthenticated},
+		{"/sf.node_manager.v1.NodeManager/Maintenance", "reader-token", codes.PermissionDenied},
+		{"/sf.node_manager.v1.NodeManager/Maintenance", "operator-token", codes.OK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.token, func(t *testing.T) {
+			authorized, err := call(server, test.method, test.token)
+			assert.Equal(t, test.expected, status.Code(err))
+			assert.Equal(t, err == nil, authorized)
+		})
+	}
+
+	authorized, err := call(server, "/sf.other.v1.Service/Do", "")
+	require.NoError(t, err)
+	assert.False(t, authorized, "other services are passed through")
+
+	withoutAuth := NewNodeManagerServer(o, nil)
+	_, err = call(withoutAuth, "/sf.node_manager.v1.NodeManager/Status", "")
+	require.NoError(t, err)
+	_, err = call(withoutAuth, "/sf.node_manager.v1.NodeManager/Backup", "operator-token")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "mutations are rejected when no authentication is configured")
+	_, err = call(withoutAuth, "/sf.node_manager.v1.NodeManager/StreamLogs", "")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "logs are not streamed when no authentication is configured")
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/derr"
+)
+
+const (
+	NotReadyStopping        = "stopping"
+	NotReadyRestoring       = "restoring"
+	NotReadyNotRunning      = "not_running"
+	NotReadyChainNotReady   = "chain_not_ready"
+	NotReadyHeadBehind      = "head_behind"
+	NotReadyUploaderBacklog = "uploader_backlog"
+)
+
+// NotReadyReason explains why the node is not ready, `Code` is one of the
+// `NotReady...` constants
+type NotReadyReason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type readinessStatus struct {
+	Ready   bool              `json:"ready"`
+	Reasons []*NotReadyReason `json:"reasons,omitempty"`
+}
+
+func (o *Operator) healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	if reason := o.notReadyReason(); reason != "" {
+		http.Error(w, "not ready: "+reason, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Write([]byte("ready\n"))
+}
+
+func (o *Operator) readyzHandler(w http.ResponseWriter, _ *http.Request) {
+	reasons := o.notReadyReasons()
+	if len(reasons) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, &readinessStatus{Ready: false, Reasons: reasons})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &readinessStatus{Ready: true})
+}
+
+// livezHandler only fails when the operator loop is gone or the process died
+// without the operator handling it, a node catching up or in maintenance is alive.
+func (o *Operator) livezHandler(w http.ResponseWriter, _ *http.Request) {
+	if reason := o.notAliveReason(); reason != "" {
+		http.Error(w, "not alive: "+reason, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Write([]byte("alive\n"))
+}
+
+// IsReady is the readiness reported by the `/healthz` endpoint
+func (o *Operator) IsReady() bool {
+	return len(o.notReadyReasons()) == 0
+}
+
+func (o *Operator) notReadyReason() string {
+	return formatNotReadyReasons(o.notReadyReasons())
+}
+
+func formatNotReadyReasons(reasons []*NotReadyReason) string {
+	messages := make([]string, len(reasons))
+	for i, reason := range reasons {
+		messages[i] = reason.Message
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (o *Operator) notReadyReasons() (reasons []*NotReadyReason) {
+	if o.aboutToStop.Load() || o.IsTerminating() || derr.IsShuttingDown() {
+		reasons = append(reasons, &NotReadyReason{NotReadyStopping, "chain about to stop"})
+	}
+
+	if current := o.runningCommand(); current != nil && current.cmd == "restore" {
+		reasons = append(reasons, &NotReadyReason{NotReadyRestoring, fmt.Sprintf("restore %s in progress", current.id)})
+	}
+
+	if !o.Superviser.IsRunning() {
+		reasons = append(reasons, &NotReadyReason{NotReadyNotRunning, "chain is not running"})
+	} else if !o.chainReadiness.IsReady() {
+		reasons = append(reasons, o.chainNotReadyReason())
+	}
+
+	if o.options.MaxUploaderBacklog > 0 && o.options.UploaderBacklogSource != nil {
+		if backlog := o.options.UploaderBacklogSource.UploaderBacklog(); backlog > o.options.MaxUploaderBacklog {
+			reasons = append(reasons, &NotReadyReason{NotReadyUploaderBacklog, fmt.Sprintf("uploader backlog of %d files is above %d", backlog, o.options.MaxUploaderBacklog)})
+		}
+	}
+
+	return reasons
+}
+
+func (o *Operator) chainNotReadyReason() *NotReadyReason {
+	if o.options.HeadBlockSource != nil {
+		if ref, blockTime := o.options.HeadBlockSource.LastHeadBlock(); ref != nil && !blockTime.IsZero() {
+			drift := time.Since(blockTime).Truncate(time.Second)
+			return &NotReadyReason{NotReadyHeadBehind, fmt.Sprintf("head block #%d is %s behind", ref.Num(), drift)}
+		}
+	}
+
+	return &NotReadyReason{NotReadyChainNotReady, "chain is not ready"}
+}
+
+func (o *Operator) notAliveReason() string {
+	if !o.launched.Load() {
+		return "operator loop is not running"
+	}
+
+	if o.expectRunning.Load() && !o.recovering.Load() && !o.Superviser.IsRunning() {
+		return "process is not running"
+	}
+
+	return ""
+}
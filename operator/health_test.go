@@ -0,0 +1,75 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/shutter"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+type testReadiness bool
+
+func (r testReadiness) IsReady() bool { return bool(r) }
+
+func TestOperator_NotReadyReasons(t *testing.T) {
+	superviser := &testSuperviser{running: true}
+	o := &Operator{
+		Shutter:        shutter.New(),
+		options:        &Options{MaxUploaderBacklog: 10},
+		Superviser:     superviser,
+		chainReadiness: testReadiness(true),
+		aboutToStop:    atomic.NewBool(false),
+		zlogger:        zap.NewNop(),
+	}
+
+	assert.Empty(t, o.notReadyReasons())
+	assert.True(t, o.IsReady())
+
+	source := &testStatusSource{headBlock: bstream.NewBlockRef("00000014a", 20), headBlockTime: time.Now().Add(-time.Hour), backlog: 11}
+	o.options.HeadBlockSource, o.options.UploaderBacklogSource = source, source
+	o.chainReadiness = testReadiness(false)
+	assert.Equal(t, []*NotReadyReason{
+		{NotReadyHeadBehind, "head block #20 is 1h0m0s behind"},
+		{NotReadyUploaderBacklog, "uploader backlog of 11 files is above 10"},
+	}, o.notReadyReasons())
+
+	superviser.running = false
+	o.aboutToStop.Store(true)
+	o.setCurrentCommand(&Command{id: "abc", cmd: "restore"})
+	assert.Equal(t, []*NotReadyReason{
+		{NotReadyStopping, "chain about to stop"},
+		{NotReadyRestoring, "restore abc in progress"},
+		{NotReadyNotRunning, "chain is not running"},
+		{NotReadyUploaderBacklog, "uploader backlog of 11 files is above 10"},
+	}, o.notReadyReasons())
+	assert.Equal(t, "chain about to stop; restore abc in progress; chain is not running; uploader backlog of 11 files is above 10", o.notReadyReason())
+}
+
+func TestOperator_NotAliveReason(t *testing.T) {
+	superviser := &testSuperviser{}
+	o := &Operator{
+		Superviser:    superviser,
+		launched:      atomic.NewBool(false),
+		expectRunning: atomic.NewBool(false),
+		recovering:    atomic.NewBool(false),
+	}
+
+	assert.Equal(t, "operator loop is not running", o.notAliveReason())
+
+	o.launched.Store(true)
+	assert.Equal(t, "", o.notAliveReason(), "process stopped on purpose")
+
+	o.expectRunning.Store(true)
+	assert.Equal(t, "process is not running", o.notAliveReason())
+
+	o.recovering.Store(true)
+	assert.Equal(t, "", o.notAliveReason(), "operator is handling the stop")
+
+	o.recovering.Store(false)
+	superviser.running = true
+	assert.Equal(t, "", o.notAliveReason())
+}
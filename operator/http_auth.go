@@ -0,0 +1,338 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type Role string
+
+const (
+	// RoleNone marks routes open to unauthenticated callers
+	RoleNone Role = ""
+	// RoleReader can call the read-only routes
+	RoleReader Role = "reader"
+	// RoleOperator can call every route, including the ones changing the node state
+	RoleOperator Role = "operator"
+)
+
+func parseRole(in string) (Role, error) {
+	switch Role(in) {
+	case RoleReader, RoleOperator:
+		return Role(in), nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role %q, accepted roles are %q and %q", in, RoleReader, RoleOperator)
+	}
+}
+
+// Identity is an authenticated caller of the HTTP API
+type Identity struct {
+	Name  string
+	Roles []Role
+	// Method is how the caller was authenticated, like "token" or "mtls"
+	Method string
+}
+
+// HasRole reports if the identity is granted `role`, the operator role implies the reader role.
+func (i *Identity) HasRole(role Role) bool {
+	if role == RoleNone {
+		return true
+	}
+
+	for _, granted := range i.Roles {
+		if granted == role || granted == RoleOperator {
+			return true
+		}
+	}
+
+	return false
+}
+
+var errInvalidCredentials = errors.New("invalid credentials")
+var errAuthenticationRequired = errors.New("authentication required")
+
+type missingRoleError struct {
+	role Role
+}
+
+func (e *missingRoleError) Error() string {
+	return fmt.Sprintf("role %q required", e.role)
+}
+
+// Authenticator identifies the caller of a request. It returns a nil identity when
+// the request does not carry credentials it handles, and an error when it carries
+// invalid ones.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// BearerTokenAuthenticator authenticates requests through the `Authorization:
+// Bearer <token>` header against a static set of tokens.
+type BearerTokenAuthenticator struct {
+	identities map[[sha256.Size]byte]*Identity
+}
+
+// NewBearerTokenAuthenticatorFromFile loads the tokens from `path`, each line being
+// `<token> <name> <role>[,<role>...]`. Empty lines and lines starting with `#` are
+// ignored.
+func NewBearerTokenAuthenticatorFromFile(path string) (*BearerTokenAuthenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open tokens file: %w", err)
+	}
+	defer file.Close()
+
+	authenticator := &BearerTokenAuthenticator{identities: map[[sha256.Size]byte]*Identity{}}
+
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("tokens file %q line %d: expected '<token> <name> <roles>', got %d fields", path, lineNum, len(fields))
+		}
+
+		identity := &Identity{Name: fields[1], Method: "token"}
+		for _, in := range strings.Split(fields[2], ",") {
+			role, err := parseRole(in)
+			if err != nil {
+				return nil, fmt.Errorf("tokens file %q line %d: %w", path, lineNum, err)
+			}
+			identity.Roles = append(identity.Roles, role)
+		}
+
+		authenticator.identities[sha256.Sum256([]byte(fields[0]))] = identity
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read tokens file: %w", err)
+	}
+
+	return authenticator, nil
+}
+
+func (a *BearerTokenAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, nil
+	}
+
+	// Tokens are looked up by hash so the lookup time does not depend on how much of a token matches
+	identity, found := a.identities[sha256.Sum256([]byte(header[len(prefix):]))]
+	if !found {
+		return nil, errInvalidCredentials
+	}
+
+	return identity, nil
+}
+
+// ClientCertAuthenticator authenticates requests through the TLS client certificate
+// verified by the server, the certificate common name being the identity name.
+// Certificates are only considered when the server verified them against its
+// client CA.
+type ClientCertAuthenticator struct {
+	// RolesByCommonName grants roles per certificate common name
+	RolesByCommonName map[string][]Role
+	// DefaultRoles are granted to verified certificates not found in RolesByCommonName
+	DefaultRoles []Role
+}
+
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+
+	commonName := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	roles, found := a.RolesByCommonName[commonName]
+	if !found {
+		roles = a.DefaultRoles
+	}
+
+	return &Identity{Name: commonName, Roles: roles, Method: "mtls"}, nil
+}
+
+// AuthConfig protects the routes of the HTTP server, see `Operator.WithAuth`, and
+// the RPCs of the gRPC service, see `NodeManagerServer.UnaryInterceptor`.
+type AuthConfig struct {
+	// Authenticators are tried in order, the first one identifying the caller wins
+	Authenticators []Authenticator
+
+	// RouteRoles overrides the role required by routes, keyed by method and path
+	// template like "GET /v1/commands", or by gRPC full method name like
+	// "/sf.node_manager.v1.NodeManager/Status". By default the probes and the status
+	// routes and RPCs are open, the backup listing, the commands history and the logs
+	// require the reader role and the routes and RPCs changing the node state require
+	// the operator role.
+	RouteRoles map[string]Role
+
+	// AuditLogger receives an entry for every authorized request changing the node
+	// state, defaults to the operator logger named "audit"
+	AuditLogger *zap.Logger
+}
+
+// readerRoutes expose the backups and the commands history, they are not open like
+// the other GET routes
+var readerRoutes = map[string]bool{
+	"GET /v1/list_backups":  true,
+	"GET /v1/commands":      true,
+	"GET /v1/commands/{id}": true,
+}
+
+func (c *AuthConfig) requiredRole(r *http.Request) Role {
+	key := r.Method + " " + r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			key = r.Method + " " + template
+		}
+	}
+
+	if role, found := c.RouteRoles[key]; found {
+		return role
+	}
+
+	if readerRoutes[key] {
+		return RoleReader
+	}
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return RoleNone
+	}
+
+	return RoleOperator
+}
+
+func (c *AuthConfig) auditLogger(fallback *zap.Logger) *zap.Logger {
+	if c.AuditLogger != nil {
+		return c.AuditLogger
+	}
+
+	return fallback.Named("audit")
+}
+
+// authorize identifies the caller of `r` and checks it is granted `role`, the error
+// is `errAuthenticationRequired` without credentials and a `*missingRoleError` when
+// the role is not granted, any other error means the credentials are invalid.
+func (c *AuthConfig) authorize(r *http.Request, role Role) (*Identity, error) {
+	identity, err := c.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity == nil {
+		return nil, errAuthenticationRequired
+	}
+
+	if !identity.HasRole(role) {
+		return identity, &missingRoleError{role: role}
+	}
+
+	return identity, nil
+}
+
+func (c *AuthConfig) authenticate(r *http.Request) (*Identity, error) {
+	for _, authenticator := range c.Authenticators {
+		identity, err := authenticator.Authenticate(r)
+		if err != nil || identity != nil {
+			return identity, err
+		}
+	}
+
+	return nil, nil
+}
+
+// WithAuth authenticates the callers of the HTTP server and enforces the role
+// required by each route.
+func (o *Operator) WithAuth(config *AuthConfig) HTTPOption {
+	auditLogger := config.auditLogger(o.zlogger)
+
+	return func(r *mux.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				// Credentials are ignored on open routes, probes keep working with a stale token
+				role := config.requiredRole(req)
+				if role == RoleNone {
+					next.ServeHTTP(w, req)
+					return
+				}
+
+				identity, err := config.authorize(req, role)
+				var roleErr *missingRoleError
+				switch {
+				case err == nil:
+				case errors.As(err, &roleErr):
+					o.zlogger.Info("rejecting request missing required role", zap.String("identity", identity.Name), zap.String("role", string(role)), zap.String("path", req.URL.Path))
+					http.Error(w, err.Error(), http.StatusForbidden)
+					return
+				case err == errAuthenticationRequired:
+					w.Header().Set("WWW-Authenticate", `Bearer realm="node-manager"`)
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				default:
+					o.zlogger.Info("rejecting request with invalid credentials", zap.String("path", req.URL.Path), zap.String("remote_addr", req.RemoteAddr), zap.Error(err))
+					w.Header().Set("WWW-Authenticate", `Bearer realm="node-manager"`)
+					http.Error(w, errInvalidCredentials.Error(), http.StatusUnauthorized)
+					return
+				}
+
+				if req.Method == http.MethodGet || req.Method == http.MethodHead {
+					next.ServeHTTP(w, req)
+					return
+				}
+
+				recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+				next.ServeHTTP(recorder, req)
+
+				auditLogger.Info("authorized mutation",
+					zap.String("identity", identity.Name),
+					zap.String("auth_method", identity.Method),
+					zap.String("method", req.Method),
+					zap.String("path", req.URL.Path),
+					zap.String("query", req.URL.RawQuery),
+					zap.String("remote_addr", req.RemoteAddr),
+					zap.Int("status", recorder.status),
+				)
+			})
+		})
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,110 @@
+package operator
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/streamingfast/shutter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func TestWithAuth(t *testing.T) {
+	tokensFile := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(tokensFile, []byte(`
+# token name roles
+reader-token alice reader
+operator-token bob operator
+`), 0600))
+
+	tokens, err := NewBearerTokenAuthenticatorFromFile(tokensFile)
+	require.NoError(t, err)
+
+	o := &Operator{zlogger: zap.NewNop()}
+	r := mux.NewRouter()
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.HandleFunc("/v1/is_running", ok).Methods("GET")
+	r.HandleFunc("/v1/list_backups", ok).Methods("GET")
+	r.HandleFunc("/v1/commands", ok).Methods("GET")
+	r.HandleFunc("/v1/commands/{id}", ok).Methods("GET")
+	r.HandleFunc("/v1/queue", ok).Methods("GET")
+	r.HandleFunc("/v1/maintenance", ok).Methods("POST")
+
+	o.WithAuth(&AuthConfig{
+		Authenticators: []Authenticator{tokens},
+		RouteRoles:     map[string]Role{"GET /v1/queue": RoleOperator},
+	})(r)
+
+	tests := []struct {
+		method   string
+		path     string
+		token    string
+		expected int
+	}{
+		{"GET", "/v1/is_running", "", http.StatusOK},
+		{"GET", "/v1/is_running", "wrong-token", http.StatusOK},
+		{"GET", "/v1/commands/abc", "wrong-token", http.StatusUnauthorized},
+		{"GET", "/v1/commands/abc", "", http.StatusUnauthorized},
+		{"GET", "/v1/commands/abc", "reader-token", http.StatusOK},
+		{"GET", "/v1/commands/abc", "operator-token", http.StatusOK},
+		{"GET", "/v1/commands", "", http.StatusUnauthorized},
+		{"GET", "/v1/commands", "reader-token", http.StatusOK},
+		{"GET", "/v1/list_backups", "", http.StatusUnauthorized},
+		{"GET", "/v1/list_backups", "reader-token", http.StatusOK},
+		{"GET", "/v1/queue", "reader-token", http.StatusForbidden},
+		{"GET", "/v1/queue", "operator-token", http.StatusOK},
+		{"POST", "/v1/maintenance", "", http.StatusUnauthorized},
+		{"POST", "/v1/maintenance", "reader-token", http.StatusForbidden},
+		{"POST", "/v1/maintenance", "operator-token", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path+" "+test.token, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+			assert.Equal(t, test.expected, recorder.Code)
+		})
+	}
+}
+
+func TestNewBearerTokenAuthenticatorFromFile_Invalid(t *testing.T) {
+	tokensFile := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(tokensFile, []byte("token bob admin\n"), 0600))
+
+	_, err := NewBearerTokenAuthenticatorFromFile(tokensFile)
+	require.Error(t, err)
+}
+
+func TestWithAuth_BeforeStoppingRejection(t *testing.T) {
+	o := &Operator{Shutter: shutter.New(), aboutToStop: atomic.NewBool(true), zlogger: zap.NewNop()}
+	tokens := &BearerTokenAuthenticator{identities: map[[sha256.Size]byte]*Identity{
+		sha256.Sum256([]byte("operator-token")): {Name: "bob", Roles: []Role{RoleOperator}, Method: "token"},
+	}}
+	r := o.newHTTPRouter(o.WithAuth(&AuthConfig{Authenticators: []Authenticator{tokens}}))
+
+	serve := func(token string) int {
+		req := httptest.NewRequest("POST", "/v1/maintenance", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(""), "unauthenticated callers do not learn the node is stopping")
+	assert.Equal(t, http.StatusServiceUnavailable, serve("operator-token"))
+}
@@ -15,22 +15,65 @@
 package operator
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/streamingfast/derr"
 	"go.uber.org/zap"
 )
 
 type HTTPOption func(r *mux.Router)
 
+const defaultHTTPShutdownTimeout = 10 * time.Second
+
+var errOperatorShuttingDown = errors.New("operator is shutting down")
+
 func (o *Operator) RunHTTPServer(httpListenAddr string, options ...HTTPOption) *http.Server {
+	o.zlogger.Info("starting webserver", zap.String("http_addr", httpListenAddr))
+	r := o.newHTTPRouter(options...)
+
+	srv := &http.Server{Addr: httpListenAddr, Handler: r}
+	if o.options.HTTPTLS != nil {
+		tlsConfig, err := o.options.HTTPTLS.serverConfig(o.zlogger)
+		if err != nil {
+			o.zlogger.Error("unable to setup TLS for http server", zap.Error(err))
+			o.Shutdown(fmt.Errorf("http server TLS: %w", err))
+			return srv
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			o.zlogger.Info("serving http server over TLS", zap.Bool("client_ca", srv.TLSConfig.ClientCAs != nil))
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+
+		if err != http.ErrServerClosed {
+			o.zlogger.Info("http server did not close correctly")
+			o.Shutdown(err)
+		}
+	}()
+
+	return srv
+}
+
+func (o *Operator) newHTTPRouter(options ...HTTPOption) *mux.Router {
 	r := mux.NewRouter()
 	r.HandleFunc("/v1/ping", o.pingHandler).Methods("GET")
 	r.HandleFunc("/healthz", o.healthzHandler).Methods("GET")
 	r.HandleFunc("/v1/healthz", o.healthzHandler).Methods("GET")
+	r.HandleFunc("/v1/readyz", o.readyzHandler).Methods("GET")
+	r.HandleFunc("/v1/livez", o.livezHandler).Methods("GET")
+	r.HandleFunc("/v1/status", o.statusHandler).Methods("GET")
 	r.HandleFunc("/v1/server_id", o.serverIDHandler).Methods("GET")
 	r.HandleFunc("/v1/is_running", o.isRunningHandler).Methods("GET")
 	r.HandleFunc("/v1/start_command", o.startcommandHandler).Methods("GET")
@@ -39,16 +82,27 @@ func (o *Operator) RunHTTPServer(httpListenAddr string, options ...HTTPOption) *
 	r.HandleFunc("/v1/backup", o.backupHandler).Methods("POST")
 	r.HandleFunc("/v1/restore", o.restoreHandler).Methods("POST")
 	r.HandleFunc("/v1/list_backups", o.listBackupsHandler).Methods("GET")
+	r.HandleFunc("/v1/verify", o.verifyHandler).Methods("POST")
+	r.HandleFunc("/v1/backup_schedules", o.backupSchedulesHandler).Methods("GET")
+	r.HandleFunc("/v1/backup_lease", o.backupLeaseHandler).Methods("GET")
 	r.HandleFunc("/v1/reload", o.reloadHandler).Methods("POST")
 	r.HandleFunc("/v1/safely_reload", o.safelyReloadHandler).Methods("POST")
 	r.HandleFunc("/v1/safely_pause_production", o.safelyPauseProdHandler).Methods("POST")
 	r.HandleFunc("/v1/safely_resume_production", o.safelyResumeProdHandler).Methods("POST")
+	r.HandleFunc("/v1/commands", o.listCommandsHandler).Methods("GET")
+	r.HandleFunc("/v1/queue", o.queueHandler).Methods("GET")
+	r.HandleFunc("/v1/commands/{id}", o.getCommandHandler).Methods("GET")
+	r.HandleFunc("/v1/commands/{id}/cancel", o.cancelCommandHandler).Methods("POST")
+	r.HandleFunc("/v1/journal/interrupted", o.interruptedOperationsHandler).Methods("GET")
+	r.HandleFunc("/v1/journal/acknowledge", o.acknowledgeInterruptedHandler).Methods("POST")
 
 	for _, opt := range options {
 		opt(r)
 	}
 
-	o.zlogger.Info("starting webserver", zap.String("http_addr", httpListenAddr))
+	// Registered after the options, callers are authenticated (see `WithAuth`) before learning the node is stopping
+	r.Use(o.rejectMutationsWhileStopping)
+
 	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		pathTemplate, err := route.GetPathTemplate()
 		if err == nil {
@@ -69,15 +123,61 @@ func (o *Operator) RunHTTPServer(httpListenAddr string, options ...HTTPOption) *
 		o.zlogger.Error("walking route methods", zap.Error(err))
 	}
 
-	srv := &http.Server{Addr: httpListenAddr, Handler: r}
-	go func() {
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			o.zlogger.Info("http server did not close correctly")
-			o.Shutdown(err)
+	return r
+}
+
+// shutdownHTTPServer answers the requests waiting on queued commands, which will
+// never run, then lets in-flight requests complete before closing the server.
+func (o *Operator) shutdownHTTPServer() {
+	for _, c := range o.commandQueue.drain() {
+		o.zlogger.Info("dropping queued command, operator is shutting down", zap.Object("command", c))
+		c.Return(errOperatorShuttingDown)
+	}
+
+	if o.httpServer == nil {
+		return
+	}
+
+	timeout := o.options.HTTPShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultHTTPShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	o.zlogger.Info("shutting down http server, waiting for in-flight requests", zap.Duration("timeout", timeout))
+	if err := o.httpServer.Shutdown(ctx); err != nil {
+		o.zlogger.Warn("http server did not shut down in time, closing remaining connections", zap.Error(err))
+		o.httpServer.Close()
+	}
+}
+
+// stopping reports if the process is about to stop or the operator is shutting
+// down, commands changing the node state are not accepted meanwhile
+func (o *Operator) stopping() bool {
+	return o.aboutToStop.Load() || o.IsTerminating()
+}
+
+// rejectMutationsWhileStopping answers 503 to requests changing the node state
+// while it is stopping. Canceling commands stays possible.
+func (o *Operator) rejectMutationsWhileStopping(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || !o.stopping() {
+			next.ServeHTTP(w, r)
+			return
 		}
-	}()
 
-	return srv
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil && template == "/v1/commands/{id}/cancel" {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "node is stopping, try again later", http.StatusServiceUnavailable)
+	})
 }
 
 func (o *Operator) pingHandler(w http.ResponseWriter, _ *http.Request) {
@@ -103,31 +203,25 @@ func (o *Operator) serverIDHandler(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte(id))
 }
 
-func (o *Operator) healthzHandler(w http.ResponseWriter, _ *http.Request) {
-	if !o.Superviser.IsRunning() {
-		http.Error(w, "not ready: chain is not running", http.StatusServiceUnavailable)
-		return
-	}
+func (o *Operator) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	o.triggerReloadCommand("reload", w, r)
+}
 
-	if !o.chainReadiness.IsReady() {
-		http.Error(w, "not ready: chain is not ready", http.StatusServiceUnavailable)
-		return
-	}
+func (o *Operator) safelyReloadHandler(w http.ResponseWriter, r *http.Request) {
+	o.triggerReloadCommand("safely_reload", w, r)
+}
 
-	if o.aboutToStop.Load() || derr.IsShuttingDown() {
-		http.Error(w, "not ready: chain about to stop", http.StatusServiceUnavailable)
+// triggerReloadCommand issues a reload, swapping the command when `reload_config`
+// is set, see `reloadRequest`
+func (o *Operator) triggerReloadCommand(cmdName string, w http.ResponseWriter, r *http.Request) {
+	// Removed parameters are read to reject them, instead of silently ignoring them
+	params := getRequestParams(r, append(append([]string{}, reloadParamNames...), removedReloadParamNames...)...)
+	if _, err := parseReloadRequest(params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Write([]byte("ready\n"))
-}
-
-func (o *Operator) reloadHandler(w http.ResponseWriter, r *http.Request) {
-	o.triggerWebCommand("reload", nil, w, r)
-}
-
-func (o *Operator) safelyReloadHandler(w http.ResponseWriter, r *http.Request) {
-	o.triggerWebCommand("safely_reload", nil, w, r)
+	o.triggerWebCommand(cmdName, params, w, r)
 }
 
 func (o *Operator) safelyResumeProdHandler(w http.ResponseWriter, r *http.Request) {
@@ -139,13 +233,31 @@ func (o *Operator) safelyPauseProdHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (o *Operator) restoreHandler(w http.ResponseWriter, r *http.Request) {
-	params := getRequestParams(r, "backupName", "backupTag", "forceVerify")
+	params := getRequestParams(r, "name", "backupName", "backupTag", "blockNum", "forceVerify")
 	o.triggerWebCommand("restore", params, w, r)
 }
 
+func (o *Operator) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	params := getRequestParams(r, "name", "backupName", "backupTag", "blockNum")
+	o.triggerWebCommand("verify", params, w, r)
+}
+
 func (o *Operator) listBackupsHandler(w http.ResponseWriter, r *http.Request) {
-	params := getRequestParams(r, "offset", "limit")
-	o.triggerWebCommand("list", params, w, r)
+	params := getRequestParams(r, "name", "offset", "limit")
+
+	// Listing is always synchronous, the caller is interested in the result
+	c, err := o.sendCommandAndWait(r.Context(), o.newCommand("list", params))
+	if err == ErrCommandQueueFull {
+		writeQueueFull(w, err)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("ERROR: list failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c.Result())
 }
 
 func getRequestParams(r *http.Request, terms ...string) map[string]string {
@@ -159,6 +271,25 @@ func getRequestParams(r *http.Request, terms ...string) map[string]string {
 	return params
 }
 
+func (o *Operator) backupSchedulesHandler(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, o.backupScheduleStatuses())
+}
+
+func (o *Operator) backupLeaseHandler(w http.ResponseWriter, r *http.Request) {
+	if o.options.BackupLease == nil {
+		http.Error(w, "no backup lease configured", http.StatusNotFound)
+		return
+	}
+
+	status, err := o.backupLeaseStatus(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to retrieve backup lease: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
 func (o *Operator) backupHandler(w http.ResponseWriter, r *http.Request) {
 	o.triggerWebCommand("backup", nil, w, r)
 }
@@ -179,34 +310,154 @@ func (o *Operator) resumeHandler(w http.ResponseWriter, r *http.Request) {
 	o.triggerWebCommand("resume", params, w, r)
 }
 
+func (o *Operator) listCommandsHandler(w http.ResponseWriter, _ *http.Request) {
+	commands := o.commandHistory.list()
+
+	statuses := make([]*CommandStatus, len(commands))
+	for i, c := range commands {
+		statuses[i] = c.Status()
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (o *Operator) getCommandHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	c := o.commandHistory.get(id)
+	if c == nil {
+		http.Error(w, fmt.Sprintf("command %q not found", id), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c.Status())
+}
+
+func (o *Operator) cancelCommandHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	c := o.commandHistory.get(id)
+	if c == nil {
+		http.Error(w, fmt.Sprintf("command %q not found", id), http.StatusNotFound)
+		return
+	}
+
+	if !c.Cancel() {
+		writeJSON(w, http.StatusConflict, c.Status())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, c.Status())
+}
+
+func (o *Operator) interruptedOperationsHandler(w http.ResponseWriter, _ *http.Request) {
+	interrupted := o.pendingInterruptedOperations()
+	if interrupted == nil {
+		interrupted = []*JournalEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, interrupted)
+}
+
+func (o *Operator) acknowledgeInterruptedHandler(w http.ResponseWriter, r *http.Request) {
+	o.triggerWebCommand("acknowledge_interrupted", nil, w, r)
+}
+
 func (o *Operator) triggerWebCommand(cmdName string, params map[string]string, w http.ResponseWriter, r *http.Request) {
-	c := &Command{cmd: cmdName, logger: o.zlogger}
-	c.params = params
+	var timeout time.Duration
+	if value := r.FormValue("timeout"); value != "" {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			http.Error(w, fmt.Sprintf("invalid timeout %q, expecting a positive duration like '30m'", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	c := o.newCommand(cmdName, params)
+	if timeout > 0 {
+		c.timeout = timeout
+	}
+
 	sync := r.FormValue("sync")
 	if sync == "true" {
-		o.sendCommandSync(c, w)
+		o.sendCommandSync(r.Context(), c, w)
 	} else {
 		o.sendCommandAsync(c, w)
 	}
 }
 
 func (o *Operator) sendCommandAsync(c *Command, w http.ResponseWriter) {
-	o.zlogger.Info("sending async command to operator through channel", zap.Object("command", c))
-	o.commandChan <- c
-	w.WriteHeader(http.StatusCreated)
-	_, _ = w.Write([]byte(fmt.Sprintf("%s command submitted\n", c.cmd)))
+	o.zlogger.Info("sending async command to operator queue", zap.Object("command", c))
+	queued, err := o.enqueue(c)
+	if err != nil {
+		writeQueueFull(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/v1/commands/"+queued.id)
+	writeJSON(w, http.StatusCreated, queued.Status())
 }
 
-func (o *Operator) sendCommandSync(c *Command, w http.ResponseWriter) {
-	o.zlogger.Info("sending sync command to operator through channel", zap.Object("command", c))
-	c.returnch = make(chan error)
-	o.commandChan <- c
-	err := <-c.returnch
+func (o *Operator) sendCommandSync(ctx context.Context, c *Command, w http.ResponseWriter) {
+	queued, err := o.sendCommandAndWait(ctx, c)
+	if err == ErrCommandQueueFull {
+		writeQueueFull(w, err)
+		return
+	}
+
 	if err == nil {
-		w.Write([]byte(fmt.Sprintf("Success: %s completed\n", c.cmd)))
+		writeJSON(w, http.StatusOK, queued.Status())
 	} else {
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write([]byte(fmt.Sprintf("ERROR: %s failed: %s \n", c.cmd, err)))
+		writeJSON(w, http.StatusInternalServerError, queued.Status())
 	}
+}
+
+// sendCommandAndWait queues `c` and waits for its completion, it returns the
+// command that ran, which is an identical pending command when there was one.
+// When `ctx` is done first, the command keeps running and `ctx` error is returned.
+func (o *Operator) sendCommandAndWait(ctx context.Context, c *Command) (*Command, error) {
+	o.zlogger.Info("sending sync command to operator queue", zap.Object("command", c))
+	queued, err := o.enqueue(c)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-queued.Done():
+		return queued, queued.Err()
+	case <-queued.Context().Done():
+		// The context is also canceled on completion
+		if queued.completed() {
+			return queued, queued.Err()
+		}
+
+		// Modules that cannot be aborted keep running, the client gets an answer anyway
+		return queued, queued.contextError()
+	case <-ctx.Done():
+		return queued, ctx.Err()
+	}
+}
+
+func (o *Operator) queueHandler(w http.ResponseWriter, _ *http.Request) {
+	commands := o.commandQueue.list()
+
+	statuses := make([]*CommandStatus, len(commands))
+	for i, c := range commands {
+		statuses[i] = c.Status()
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func writeQueueFull(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", "30")
+	writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
 
+	_ = json.NewEncoder(w).Encode(v)
 }
@@ -0,0 +1,89 @@
+package operator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/streamingfast/shutter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func TestRejectMutationsWhileStopping(t *testing.T) {
+	o := &Operator{Shutter: shutter.New(), aboutToStop: atomic.NewBool(false), zlogger: zap.NewNop()}
+
+	r := mux.NewRouter()
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.HandleFunc("/v1/is_running", ok).Methods("GET")
+	r.HandleFunc("/v1/maintenance", ok).Methods("POST")
+	r.HandleFunc("/v1/commands/{id}/cancel", ok).Methods("POST")
+	r.Use(o.rejectMutationsWhileStopping)
+
+	serve := func(method, path string) int {
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("POST", "/v1/maintenance"))
+
+	o.aboutToStop.Store(true)
+	assert.Equal(t, http.StatusServiceUnavailable, serve("POST", "/v1/maintenance"))
+	assert.Equal(t, http.StatusOK, serve("GET", "/v1/is_running"))
+	assert.Equal(t, http.StatusOK, serve("POST", "/v1/commands/abc/cancel"))
+
+	o.aboutToStop.Store(false)
+	o.Shutdown(nil)
+	assert.Equal(t, http.StatusServiceUnavailable, serve("POST", "/v1/maintenance"))
+}
+
+func TestShutdownHTTPServer_AnswersQueuedCommands(t *testing.T) {
+	o := &Operator{
+		options:        &Options{},
+		commandQueue:   newCommandQueue(0),
+		commandHistory: newCommandHistory(0),
+		zlogger:        zap.NewNop(),
+	}
+
+	queued, err := o.enqueue(o.newCommand("backup", nil))
+	require.NoError(t, err)
+
+	o.shutdownHTTPServer()
+
+	<-queued.Done()
+	assert.Equal(t, errOperatorShuttingDown, queued.Err())
+	assert.Empty(t, o.commandQueue.list())
+}
+
+func TestTriggerWebCommand_InvalidTimeout(t *testing.T) {
+	o := &Operator{
+		options:        &Options{},
+		commandQueue:   newCommandQueue(0),
+		commandHistory: newCommandHistory(10),
+		zlogger:        zap.NewNop(),
+	}
+
+	recorder := httptest.NewRecorder()
+	o.triggerWebCommand("backup", nil, recorder, httptest.NewRequest("POST", "/v1/backup?timeout=soon", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Empty(t, o.commandHistory.list(), "rejected command must not be recorded")
+	assert.Empty(t, o.commandQueue.list())
+}
+
+func TestTriggerReloadCommand_RejectsCommandParams(t *testing.T) {
+	o := &Operator{
+		options:        &Options{},
+		commandQueue:   newCommandQueue(0),
+		commandHistory: newCommandHistory(10),
+		zlogger:        zap.NewNop(),
+	}
+
+	recorder := httptest.NewRecorder()
+	o.triggerReloadCommand("reload", recorder, httptest.NewRequest("POST", "/v1/reload?binary=/bin/sh", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Empty(t, o.commandQueue.list())
+}
@@ -0,0 +1,170 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultCertificateCheckInterval = 30 * time.Second
+
+// TLSConfig enables TLS on the operator HTTP server, see `Options.HTTPTLS`.
+type TLSConfig struct {
+	// CertFile and KeyFile are reloaded when they change on disk, so renewed
+	// certificates are picked up without restarting
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile enables client certificate verification against the CA bundle it
+	// contains, certificates are then required unless OptionalClientCert is set
+	ClientCAFile       string
+	OptionalClientCert bool
+
+	// CheckInterval is how often the certificate files are checked for changes, defaults to 30s
+	CheckInterval time.Duration
+}
+
+func (o *Operator) TLSEnabled() bool {
+	return o.options.HTTPTLS != nil
+}
+
+func (c *TLSConfig) serverConfig(logger *zap.Logger) (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("both certificate and key files are required")
+	}
+
+	reloader := &certificateReloader{
+		certFile:      c.CertFile,
+		keyFile:       c.KeyFile,
+		checkInterval: c.CheckInterval,
+		logger:        logger,
+	}
+	if reloader.checkInterval <= 0 {
+		reloader.checkInterval = defaultCertificateCheckInterval
+	}
+
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if c.ClientCAFile != "" {
+		content, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificate found in client CA file %q", c.ClientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		if c.OptionalClientCert {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return config, nil
+}
+
+// certificateReloader serves the certificate from disk, reloading it when the
+// certificate or key file modification time changes. A certificate failing to
+// load is logged and the previous one keeps being served.
+type certificateReloader struct {
+	certFile      string
+	keyFile       string
+	checkInterval time.Duration
+	logger        *zap.Logger
+
+	lock      sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	lastCheck time.Time
+}
+
+func (r *certificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if time.Since(r.lastCheck) >= r.checkInterval {
+		r.lastCheck = time.Now()
+
+		certMod, keyMod, err := r.modTimes()
+		if err != nil {
+			r.logger.Warn("unable to check TLS certificate files for changes", zap.Error(err))
+		} else if !certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod) {
+			if err := r.loadLocked(); err != nil {
+				r.logger.Error("unable to reload TLS certificate, keeping previous one", zap.Error(err))
+			} else {
+				r.logger.Info("reloaded TLS certificate", zap.String("cert_file", r.certFile))
+			}
+		}
+	}
+
+	return r.cert, nil
+}
+
+func (r *certificateReloader) load() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.lastCheck = time.Now()
+	return r.loadLocked()
+}
+
+func (r *certificateReloader) loadLocked() error {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	return nil
+}
+
+func (r *certificateReloader) modTimes() (certMod, keyMod time.Time, err error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return certMod, keyMod, fmt.Errorf("stat certificate file: %w", err)
+	}
+
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return certMod, keyMod, fmt.Errorf("stat key file: %w", err)
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
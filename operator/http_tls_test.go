@@ -0,0 +1,90 @@
+package operator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTLSConfig_ReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestCertificate(t, certFile, keyFile, "first")
+
+	config, err := (&TLSConfig{CertFile: certFile, KeyFile: keyFile, CheckInterval: time.Nanosecond}).serverConfig(zap.NewNop())
+	require.NoError(t, err)
+
+	assert.Equal(t, "first", servedCommonName(t, config.GetCertificate))
+
+	writeTestCertificate(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	assert.Equal(t, "second", servedCommonName(t, config.GetCertificate))
+
+	require.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0600))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	assert.Equal(t, "second", servedCommonName(t, config.GetCertificate), "previous certificate kept when reload fails")
+}
+
+func TestTLSConfig_Invalid(t *testing.T) {
+	_, err := (&TLSConfig{CertFile: "tls.crt"}).serverConfig(zap.NewNop())
+	require.Error(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestCertificate(t, certFile, keyFile, "server")
+
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0600))
+
+	_, err = (&TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}).serverConfig(zap.NewNop())
+	require.Error(t, err)
+}
+
+func servedCommonName(t *testing.T, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) string {
+	t.Helper()
+
+	cert, err := getCertificate(nil)
+	require.NoError(t, err)
+
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func writeTestCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
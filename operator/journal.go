@@ -0,0 +1,405 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	nodeManager "github.com/streamingfast/node-manager"
+	"go.uber.org/zap"
+)
+
+type JournalEvent string
+
+const (
+	JournalEventStarted      JournalEvent = "started"
+	JournalEventSubCommand   JournalEvent = "sub_command"
+	JournalEventCompleted    JournalEvent = "completed"
+	JournalEventFailed       JournalEvent = "failed"
+	JournalEventAcknowledged JournalEvent = "acknowledged"
+)
+
+// JournalPolicy defines what the operator does on startup when the journal
+// contains operations that never completed.
+type JournalPolicy string
+
+const (
+	// JournalPolicyRefuse keeps the node stopped until an operator acknowledges
+	// the interrupted operations through `POST /v1/journal/acknowledge`.
+	// Until then, `restore` is the only journaled command accepted.
+	JournalPolicyRefuse JournalPolicy = "refuse"
+
+	// JournalPolicyResume runs the interrupted commands again, with the same parameters.
+	JournalPolicyResume JournalPolicy = "resume"
+
+	// JournalPolicyRollback restores the latest backup of the module an interrupted
+	// `restore` was using. Interrupted backups are simply acknowledged.
+	JournalPolicyRollback JournalPolicy = "rollback"
+)
+
+// journaledCommands are the commands that leave the node in a state that is unsafe
+// to start from if they do not run to completion.
+var journaledCommands = map[string]bool{
+	"backup":  true,
+	"restore": true,
+}
+
+// dataMutatingCommands are the journaled commands that may leave the data
+// unusable when they fail, their failures stay interrupted operations. Other
+// commands leave the data intact when they fail.
+var dataMutatingCommands = map[string]bool{
+	"restore": true,
+}
+
+type JournalEntry struct {
+	Time    time.Time         `json:"time"`
+	Event   JournalEvent      `json:"event"`
+	ID      string            `json:"id"`
+	Command string            `json:"command"`
+	Params  map[string]string `json:"params,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// Journal is an append-only file of command events, each line being a JSON
+// encoded `JournalEntry`. Each write is synced to disk so the journal can be
+// trusted after a crash. The operator compacts it each time an operation settles.
+type Journal struct {
+	path string
+
+	lock sync.Mutex
+	file *os.File
+}
+
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("create journal directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal %q: %w", path, err)
+	}
+
+	return &Journal{path: path, file: file}, nil
+}
+
+func (j *Journal) Append(entry *JournalEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal journal entry: %w", err)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write journal entry: %w", err)
+	}
+
+	return j.file.Sync()
+}
+
+// Entries reads back every entry of the journal, a truncated last line (crash
+// while writing) is ignored.
+func (j *Journal) Entries() ([]*JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.readEntries()
+}
+
+func (j *Journal) readEntries() ([]*JournalEntry, error) {
+	file, err := os.Open(j.path)
+	if err != nil {
+		return nil, fmt.Errorf("open journal %q: %w", j.path, err)
+	}
+	defer file.Close()
+
+	var entries []*JournalEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := &JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read journal %q: %w", j.path, err)
+	}
+
+	return entries, nil
+}
+
+// Interrupted replays the journal and returns the `started` entry of every
+// operation that was neither completed nor acknowledged, in journal order. Failed
+// operations are interrupted only when they mutate the data, see `dataMutatingCommands`.
+func (j *Journal) Interrupted() ([]*JournalEntry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	return interruptedOperations(entries), nil
+}
+
+// Compact rewrites the journal with the entries of the operations that are still
+// pending only, dropping the settled ones. The new journal replaces the old one
+// atomically, a crash while compacting leaves one or the other.
+func (j *Journal) Compact() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	entries, err := j.readEntries()
+	if err != nil {
+		return err
+	}
+
+	pending := map[string]bool{}
+	for _, entry := range interruptedOperations(entries) {
+		pending[entry.ID] = true
+	}
+
+	var content []byte
+	for _, entry := range entries {
+		if !pending[entry.ID] {
+			continue
+		}
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("marshal journal entry: %w", err)
+		}
+		content = append(append(content, line...), '\n')
+	}
+
+	if err := nodeManager.WriteFileAtomically(j.path, content, 0644); err != nil {
+		return fmt.Errorf("replace journal: %w", err)
+	}
+
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("reopen journal %q: %w", j.path, err)
+	}
+
+	j.file.Close()
+	j.file = file
+	return nil
+}
+
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.file.Close()
+}
+
+func interruptedOperations(entries []*JournalEntry) []*JournalEntry {
+	var order []string
+	pending := map[string]*JournalEntry{}
+
+	for _, entry := range entries {
+		switch entry.Event {
+		case JournalEventStarted:
+			if _, found := pending[entry.ID]; !found {
+				order = append(order, entry.ID)
+			}
+			pending[entry.ID] = entry
+
+		case JournalEventCompleted, JournalEventAcknowledged:
+			delete(pending, entry.ID)
+
+		case JournalEventFailed:
+			if started, found := pending[entry.ID]; found && !dataMutatingCommands[started.Command] {
+				delete(pending, entry.ID)
+			}
+		}
+	}
+
+	var out []*JournalEntry
+	for _, id := range order {
+		if entry, found := pending[id]; found {
+			out = append(out, entry)
+			delete(pending, id)
+		}
+	}
+
+	return out
+}
+
+// replayJournal opens the journal and handles the operations that were interrupted
+// by a crash according to the configured `JournalPolicy`. It returns `false` when
+// the node must not be started until an operator acknowledges the interrupted
+// operations.
+func (o *Operator) replayJournal() (startAllowed bool, err error) {
+	if o.options.JournalPath == "" {
+		return true, nil
+	}
+
+	journal, err := OpenJournal(o.options.JournalPath)
+	if err != nil {
+		return false, err
+	}
+	o.journal = journal
+	o.OnTerminated(func(_ error) {
+		if err := journal.Close(); err != nil {
+			o.zlogger.Warn("unable to close journal", zap.Error(err))
+		}
+	})
+
+	interrupted, err := journal.Interrupted()
+	if err != nil {
+		return false, fmt.Errorf("replay journal: %w", err)
+	}
+
+	if len(interrupted) == 0 {
+		o.zlogger.Info("no interrupted operations found in journal", zap.String("journal_path", o.options.JournalPath))
+		return true, journal.Compact()
+	}
+
+	for _, entry := range interrupted {
+		o.zlogger.Warn("found interrupted operation in journal",
+			zap.String("id", entry.ID),
+			zap.String("command", entry.Command),
+			zap.Reflect("params", entry.Params),
+			zap.Time("started_at", entry.Time),
+			zap.String("policy", string(o.options.JournalPolicy)),
+		)
+	}
+
+	switch o.options.JournalPolicy {
+	case JournalPolicyResume:
+		for _, entry := range interrupted {
+			if _, err := o.enqueue(o.newCommand(entry.Command, entry.Params)); err != nil {
+				return false, fmt.Errorf("resume interrupted operation %q: %w", entry.ID, err)
+			}
+		}
+		return true, o.acknowledgeInterrupted(interrupted, "resumed")
+
+	case JournalPolicyRollback:
+		for _, entry := range interrupted {
+			if entry.Command == "restore" {
+				if _, err := o.enqueue(o.newCommand("restore", map[string]string{"name": entry.Params["name"]})); err != nil {
+					return false, fmt.Errorf("roll back interrupted operation %q: %w", entry.ID, err)
+				}
+			}
+		}
+		return true, o.acknowledgeInterrupted(interrupted, "rolled back")
+
+	default:
+		o.journalLock.Lock()
+		o.interruptedOperations = interrupted
+		o.journalLock.Unlock()
+
+		o.zlogger.Warn("refusing to start until interrupted operations are acknowledged through 'POST /v1/journal/acknowledge'")
+		return false, nil
+	}
+}
+
+func (o *Operator) journalRecord(event JournalEvent, cmd *Command, err error) {
+	if o.journal == nil {
+		return
+	}
+
+	entry := &JournalEntry{Event: event, ID: cmd.id, Command: cmd.cmd, Params: cmd.params}
+	if cmd.parent != nil {
+		if !journaledCommands[cmd.parent.cmd] {
+			return
+		}
+		entry.ID = cmd.parent.id
+	} else if !journaledCommands[cmd.cmd] {
+		return
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := o.journal.Append(entry); err != nil {
+		o.zlogger.Error("unable to record command in journal", zap.Object("command", cmd), zap.String("event", string(event)), zap.Error(err))
+		return
+	}
+
+	// Settled operations are dropped so the journal does not grow forever
+	if event == JournalEventCompleted || event == JournalEventFailed || event == JournalEventAcknowledged {
+		o.compactJournal()
+	}
+}
+
+func (o *Operator) compactJournal() {
+	if err := o.journal.Compact(); err != nil {
+		o.zlogger.Warn("unable to compact journal", zap.String("journal_path", o.options.JournalPath), zap.Error(err))
+	}
+}
+
+// refuseWhileInterrupted rejects `cmd` when it is journaled and interrupted operations
+// are waiting to be acknowledged, a restore being the only journaled command allowed
+// to supersede them.
+func (o *Operator) refuseWhileInterrupted(cmd *Command) bool {
+	if !journaledCommands[cmd.cmd] || cmd.cmd == "restore" {
+		return false
+	}
+
+	interrupted := o.pendingInterruptedOperations()
+	if len(interrupted) == 0 {
+		return false
+	}
+
+	cmd.Return(fmt.Errorf("refusing to %s, %d interrupted operation(s) found in journal must be acknowledged first", cmd.cmd, len(interrupted)))
+	return true
+}
+
+func (o *Operator) pendingInterruptedOperations() []*JournalEntry {
+	o.journalLock.Lock()
+	defer o.journalLock.Unlock()
+
+	return o.interruptedOperations
+}
+
+// acknowledgeInterrupted marks the interrupted operations as settled in the
+// journal, allowing the node to be started again.
+func (o *Operator) acknowledgeInterrupted(interrupted []*JournalEntry, reason string) error {
+	o.journalLock.Lock()
+	defer o.journalLock.Unlock()
+
+	for _, entry := range interrupted {
+		err := o.journal.Append(&JournalEntry{
+			Event:   JournalEventAcknowledged,
+			ID:      entry.ID,
+			Command: entry.Command,
+			Params:  entry.Params,
+			Error:   reason,
+		})
+		if err != nil {
+			return fmt.Errorf("acknowledge interrupted operation %q: %w", entry.ID, err)
+		}
+	}
+
+	o.interruptedOperations = nil
+	o.compactJournal()
+	return nil
+}
@@ -0,0 +1,101 @@
+package operator
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/streamingfast/shutter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+func TestJournal_Interrupted(t *testing.T) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "journal", "commands.jsonl"))
+	require.NoError(t, err)
+	defer journal.Close()
+
+	restoreParams := map[string]string{"name": "tarball", "backupName": "0000001000"}
+	for _, entry := range []*JournalEntry{
+		{Event: JournalEventStarted, ID: "a", Command: "backup"},
+		{Event: JournalEventSubCommand, ID: "a", Command: "start"},
+		{Event: JournalEventCompleted, ID: "a", Command: "backup"},
+		{Event: JournalEventStarted, ID: "b", Command: "restore", Params: restoreParams},
+		{Event: JournalEventStarted, ID: "c", Command: "backup"},
+		{Event: JournalEventFailed, ID: "c", Command: "backup", Error: "boom"},
+		{Event: JournalEventAcknowledged, ID: "c", Command: "backup"},
+		{Event: JournalEventStarted, ID: "d", Command: "restore"},
+		{Event: JournalEventFailed, ID: "d", Command: "restore", Error: "boom"},
+		{Event: JournalEventStarted, ID: "e", Command: "backup"},
+		{Event: JournalEventFailed, ID: "e", Command: "backup", Error: "boom"},
+	} {
+		require.NoError(t, journal.Append(entry))
+	}
+
+	interrupted, err := journal.Interrupted()
+	require.NoError(t, err)
+	require.Len(t, interrupted, 2)
+
+	assert.Equal(t, "b", interrupted[0].ID)
+	assert.Equal(t, restoreParams, interrupted[0].Params)
+	assert.Equal(t, "d", interrupted[1].ID, "failed restore may have left the data unusable")
+
+	require.NoError(t, journal.Compact())
+	entries, err := journal.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 3, "only the entries of pending operations are kept")
+
+	interrupted, err = journal.Interrupted()
+	require.NoError(t, err)
+	require.Len(t, interrupted, 2)
+	assert.Equal(t, "b", interrupted[0].ID)
+	assert.Equal(t, "d", interrupted[1].ID)
+
+	require.NoError(t, journal.Append(&JournalEntry{Event: JournalEventAcknowledged, ID: "b", Command: "restore"}))
+	require.NoError(t, journal.Append(&JournalEntry{Event: JournalEventAcknowledged, ID: "d", Command: "restore"}))
+	require.NoError(t, journal.Compact())
+	entries, err = journal.Entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestOperator_RefusesJournaledCommandsWhileInterrupted(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "commands.jsonl")
+	journal, err := OpenJournal(journalPath)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	interrupted := &JournalEntry{Event: JournalEventStarted, ID: "a", Command: "restore"}
+	require.NoError(t, journal.Append(interrupted))
+
+	o := &Operator{
+		Shutter:               shutter.New(),
+		options:               &Options{JournalPath: journalPath, JournalPolicy: JournalPolicyRefuse},
+		Superviser:            &testSuperviser{running: false},
+		commandHistory:        newCommandHistory(10),
+		aboutToStop:           atomic.NewBool(false),
+		expectRunning:         atomic.NewBool(false),
+		zlogger:               zap.NewNop(),
+		journal:               journal,
+		interruptedOperations: []*JournalEntry{interrupted},
+	}
+	require.NoError(t, o.RegisterBackupModule("test", &testRestorableBackupModule{}))
+
+	run := func(command string, params map[string]string) error {
+		cmd := o.newCommand(command, params)
+		require.NoError(t, o.runCommand(cmd))
+		cmd.Return(nil)
+		return cmd.Err()
+	}
+
+	assert.Error(t, run("backup", nil))
+	assert.Error(t, run("start", nil))
+	require.NoError(t, run("restore", map[string]string{"backupName": "0000000010"}))
+	assert.Empty(t, o.pendingInterruptedOperations())
+	require.NoError(t, run("backup", nil))
+
+	entries, err := journal.Entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 0, "settled operations are compacted away")
+}
@@ -0,0 +1,301 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+const defaultBackupLeaseTTL = 5 * time.Minute
+
+// Lease is a time bounded exclusive right shared between node-managers, it is
+// used so only one of many node-managers sharing a backup store performs the
+// scheduled backups.
+type Lease interface {
+	// ID identifies this instance as a lease holder
+	ID() string
+
+	// Acquire takes the lease for `ttl`, or extends it when already held by this
+	// instance. It returns false when the lease is held by another instance.
+	Acquire(ctx context.Context, ttl time.Duration) (bool, error)
+
+	// Release frees the lease if it is held by this instance
+	Release(ctx context.Context) error
+
+	// Holder returns the current holder of the lease, nil when the lease is free or expired
+	Holder(ctx context.Context) (*LeaseHolder, error)
+}
+
+type LeaseHolder struct {
+	ID         string    `json:"id"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (h *LeaseHolder) expired(now time.Time) bool {
+	return !now.Before(h.ExpiresAt)
+}
+
+// DstoreLease is a `Lease` stored as a lock object in a `dstore.Store`. Object
+// stores have no compare-and-swap, so after writing the lock object the lease
+// waits `SettleDelay`, 2s by default, and reads it back: when two instances race
+// for a free lease, the last write wins and the other instance sees it lost. The
+// TTL of the lock object lets another instance take over when the holder disappears.
+//
+// The lease is only exclusive on stores with read-after-write consistency, on an
+// eventually consistent store a write landing after the settle delay can leave two
+// instances believing they hold it.
+type DstoreLease struct {
+	store      dstore.Store
+	objectName string
+	id         string
+
+	SettleDelay time.Duration
+}
+
+// NewDstoreLease creates the lease `name` in the store at `storeURL`, `id`
+// identifies this instance and defaults to the hostname when empty.
+func NewDstoreLease(storeURL string, name string, id string) (*DstoreLease, error) {
+	store, err := dstore.NewStore(storeURL, "", "", true)
+	if err != nil {
+		return nil, fmt.Errorf("new lease store: %w", err)
+	}
+
+	if id == "" {
+		id, err = os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("lease id not provided and unable to retrieve hostname: %w", err)
+		}
+	}
+
+	return &DstoreLease{
+		store:       store,
+		objectName:  name + ".lock",
+		id:          id,
+		SettleDelay: 2 * time.Second,
+	}, nil
+}
+
+func (l *DstoreLease) ID() string {
+	return l.id
+}
+
+func (l *DstoreLease) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	current, err := l.read(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	acquiredAt := now
+	if current != nil && !current.expired(now) {
+		if current.ID != l.id {
+			return false, nil
+		}
+		acquiredAt = current.AcquiredAt
+	}
+
+	if err := l.write(ctx, &LeaseHolder{ID: l.id, AcquiredAt: acquiredAt, ExpiresAt: now.Add(ttl)}); err != nil {
+		return false, err
+	}
+
+	// Renewals of a lease we already hold do not race with other instances
+	if current != nil && current.ID == l.id && !current.expired(now) {
+		return true, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-time.After(l.SettleDelay):
+	}
+
+	current, err = l.read(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return current != nil && current.ID == l.id, nil
+}
+
+func (l *DstoreLease) Release(ctx context.Context) error {
+	current, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current == nil || current.ID != l.id {
+		return nil
+	}
+
+	if err := l.store.DeleteObject(ctx, l.objectName); err != nil {
+		return fmt.Errorf("deleting lease lock object %q: %w", l.objectName, err)
+	}
+
+	return nil
+}
+
+func (l *DstoreLease) Holder(ctx context.Context) (*LeaseHolder, error) {
+	current, err := l.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil || current.expired(time.Now()) {
+		return nil, nil
+	}
+
+	return current, nil
+}
+
+func (l *DstoreLease) read(ctx context.Context) (*LeaseHolder, error) {
+	exists, err := l.store.FileExists(ctx, l.objectName)
+	if err != nil {
+		return nil, fmt.Errorf("checking lease lock object %q: %w", l.objectName, err)
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	reader, err := l.store.OpenObject(ctx, l.objectName)
+	if err != nil {
+		if errors.Is(err, dstore.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening lease lock object %q: %w", l.objectName, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading lease lock object %q: %w", l.objectName, err)
+	}
+
+	holder := &LeaseHolder{}
+	if err := json.Unmarshal(content, holder); err != nil {
+		return nil, fmt.Errorf("unmarshal lease lock object %q: %w", l.objectName, err)
+	}
+
+	return holder, nil
+}
+
+func (l *DstoreLease) write(ctx context.Context, holder *LeaseHolder) error {
+	content, err := json.Marshal(holder)
+	if err != nil {
+		return fmt.Errorf("marshal lease holder: %w", err)
+	}
+
+	if err := l.store.WriteObject(ctx, l.objectName, bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("writing lease lock object %q: %w", l.objectName, err)
+	}
+
+	return nil
+}
+
+// BackupLeaseStatus is the JSON representation of the backup lease
+type BackupLeaseStatus struct {
+	ID         string       `json:"id"`
+	Holder     *LeaseHolder `json:"holder"`
+	HeldBySelf bool         `json:"held_by_self"`
+}
+
+func (o *Operator) backupLeaseStatus(ctx context.Context) (*BackupLeaseStatus, error) {
+	lease := o.options.BackupLease
+
+	holder, err := lease.Holder(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackupLeaseStatus{
+		ID:         lease.ID(),
+		Holder:     holder,
+		HeldBySelf: holder != nil && holder.ID == lease.ID(),
+	}, nil
+}
+
+// acquireBackupLease takes the backup lease and keeps renewing it until the
+// returned finish function is called, the lease is then held for one more TTL so
+// instances whose schedules are not aligned do not back up right after this one.
+// It returns a nil finish function when the lease is held by another instance.
+func (o *Operator) acquireBackupLease() (finish func(), holder *LeaseHolder, err error) {
+	lease := o.options.BackupLease
+	ttl := o.options.BackupLeaseTTL
+	if ttl <= 0 {
+		ttl = defaultBackupLeaseTTL
+	}
+
+	acquired, err := lease.Acquire(context.Background(), ttl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acquiring backup lease: %w", err)
+	}
+
+	if !acquired {
+		holder, err := lease.Holder(context.Background())
+		if err != nil {
+			return nil, nil, fmt.Errorf("retrieving backup lease holder: %w", err)
+		}
+		return nil, holder, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				renewed, err := lease.Acquire(ctx, ttl)
+				switch {
+				case ctx.Err() != nil:
+					return
+				case err != nil:
+					o.zlogger.Warn("unable to renew backup lease", zap.Error(err))
+				case !renewed:
+					o.zlogger.Error("backup lease was taken over by another instance while backing up", zap.String("lease_id", lease.ID()))
+				}
+			}
+		}
+	}()
+
+	finish = func() {
+		cancel()
+		<-done
+
+		if _, err := lease.Acquire(context.Background(), ttl); err != nil {
+			o.zlogger.Warn("unable to extend backup lease after backup", zap.Error(err))
+		}
+	}
+
+	return finish, nil, nil
+}
@@ -0,0 +1,106 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDstoreLease(t *testing.T) {
+	ctx := context.Background()
+	storeURL := "file://" + t.TempDir()
+
+	newLease := func(id string) *DstoreLease {
+		lease, err := NewDstoreLease(storeURL, "backup", id)
+		require.NoError(t, err)
+		lease.SettleDelay = 0
+		return lease
+	}
+	a, b := newLease("a"), newLease("b")
+
+	holder, err := a.Holder(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	acquired, err := a.Acquire(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = b.Acquire(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired, "held by a")
+
+	holder, err = b.Holder(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, "a", holder.ID)
+
+	acquired, err = a.Acquire(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "renewed by a")
+
+	require.NoError(t, b.Release(ctx), "release by non-holder is a no-op")
+	holder, err = b.Holder(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+
+	require.NoError(t, a.Release(ctx))
+	acquired, err = b.Acquire(ctx, time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, acquired, "released by a")
+
+	time.Sleep(5 * time.Millisecond)
+	acquired, err = a.Acquire(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "expired lease of b")
+}
+
+type failingLease struct{}
+
+func (failingLease) ID() string { return "failing" }
+func (failingLease) Acquire(_ context.Context, _ time.Duration) (bool, error) {
+	return false, errors.New("store unavailable")
+}
+func (failingLease) Release(_ context.Context) error { return nil }
+func (failingLease) Holder(_ context.Context) (*LeaseHolder, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func TestOperator_ScheduledBackupLease(t *testing.T) {
+	newOperator := func(lease Lease) *Operator {
+		o := newTestReloadOperator(&testSuperviser{running: true})
+		o.options.BackupLease = lease
+		o.options.BackupLeaseTTL = time.Minute
+		require.NoError(t, o.RegisterBackupModule("test", &testRecoveryModule{}))
+		return o
+	}
+
+	o := newOperator(failingLease{})
+	backup := o.newScheduledCommand("backup", nil)
+	require.NoError(t, o.runCommand(backup), "lease failures do not stop the operator")
+	assert.Equal(t, CommandStateFailed, backup.Status().State)
+
+	storeURL := "file://" + t.TempDir()
+	newLease := func(id string) *DstoreLease {
+		lease, err := NewDstoreLease(storeURL, "backup", id)
+		require.NoError(t, err)
+		lease.SettleDelay = 0
+		return lease
+	}
+
+	o = newOperator(newLease("a"))
+	backup = o.newScheduledCommand("backup", nil)
+	require.NoError(t, o.runCommand(backup))
+	backup.Return(nil)
+	assert.Equal(t, CommandStateSucceeded, backup.Status().State)
+
+	holder, err := newLease("b").Holder(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, holder, "lease is kept once the backup completed")
+	assert.Equal(t, "a", holder.ID)
+	assert.True(t, holder.ExpiresAt.After(time.Now().Add(50*time.Second)))
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/dstore"
+)
+
+const manifestSuffix = ".manifest.json"
+
+// BackupManifest lists the files written by a backup, it is stored alongside the
+// backup so the backup can be verified before being restored.
+type BackupManifest struct {
+	BackupName string          `json:"backup_name"`
+	BlockNum   uint64          `json:"block_num"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Files      []*ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Link is the target of the file when it is a symlink, the file has no content then
+	Link string `json:"link,omitempty"`
+}
+
+// NewManifestFromDirectory hashes every regular file found under `root` and records
+// the target of its symlinks, paths are recorded relative to `root`.
+func NewManifestFromDirectory(root string) (*BackupManifest, error) {
+	manifest := &BackupManifest{CreatedAt: time.Now()}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		isSymlink := info.Mode()&os.ModeSymlink != 0
+		if !info.Mode().IsRegular() && !isSymlink {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if isSymlink {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			manifest.AddSymlink(filepath.ToSlash(relPath), target)
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return manifest.AddFile(filepath.ToSlash(relPath), file)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("building manifest of %q: %w", root, err)
+	}
+
+	manifest.sort()
+	return manifest, nil
+}
+
+// AddFile reads `content` until EOF and records its size and SHA-256 under `path`.
+func (m *BackupManifest) AddFile(path string, content io.Reader) error {
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, content)
+	if err != nil {
+		return fmt.Errorf("hashing %q: %w", path, err)
+	}
+
+	m.Files = append(m.Files, &ManifestFile{Path: path, Size: size, SHA256: hex.EncodeToString(hasher.Sum(nil))})
+	return nil
+}
+
+// AddSymlink records a symlink pointing to `target` under `path`.
+func (m *BackupManifest) AddSymlink(path string, target string) {
+	m.Files = append(m.Files, &ManifestFile{Path: path, Link: target})
+}
+
+func (m *BackupManifest) sort() {
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+}
+
+// Compare checks that `actual` contains exactly the files of the manifest with the
+// same sizes and checksums, the returned error lists every difference found.
+func (m *BackupManifest) Compare(actual *BackupManifest) error {
+	actualFiles := make(map[string]*ManifestFile, len(actual.Files))
+	for _, file := range actual.Files {
+		actualFiles[file.Path] = file
+	}
+
+	var problems []string
+	for _, expected := range m.Files {
+		file, found := actualFiles[expected.Path]
+		if !found {
+			problems = append(problems, fmt.Sprintf("missing file %q", expected.Path))
+			continue
+		}
+		delete(actualFiles, expected.Path)
+
+		if file.Link != expected.Link {
+			problems = append(problems, fmt.Sprintf("file %q links to %q, expected %q", expected.Path, file.Link, expected.Link))
+			continue
+		}
+
+		if file.Size != expected.Size {
+			problems = append(problems, fmt.Sprintf("file %q size is %d, expected %d", expected.Path, file.Size, expected.Size))
+			continue
+		}
+
+		if file.SHA256 != expected.SHA256 {
+			problems = append(problems, fmt.Sprintf("file %q checksum is %s, expected %s", expected.Path, file.SHA256, expected.SHA256))
+		}
+	}
+
+	var unexpected []string
+	for path := range actualFiles {
+		unexpected = append(unexpected, path)
+	}
+	sort.Strings(unexpected)
+	for _, path := range unexpected {
+		problems = append(problems, fmt.Sprintf("unexpected file %q", path))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("backup does not match manifest: %s", strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// ManifestObjectName is the name of the object holding the manifest of `backupName`
+// when stored alongside the backup in a `dstore.Store`.
+func ManifestObjectName(backupName string) string {
+	return backupName + manifestSuffix
+}
+
+func WriteManifest(ctx context.Context, store dstore.Store, manifest *BackupManifest) error {
+	manifest.sort()
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	if err := store.WriteObject(ctx, ManifestObjectName(manifest.BackupName), bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("write manifest of %q: %w", manifest.BackupName, err)
+	}
+
+	return nil
+}
+
+func ReadManifest(ctx context.Context, store dstore.Store, backupName string) (*BackupManifest, error) {
+	reader, err := store.OpenObject(ctx, ManifestObjectName(backupName))
+	if err != nil {
+		return nil, fmt.Errorf("open manifest of %q: %w", backupName, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest of %q: %w", backupName, err)
+	}
+
+	manifest := &BackupManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("unmarshal manifest of %q: %w", backupName, err)
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,65 @@
+package operator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewManifestFromDirectory(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "blocks", "blocks.log"), "some blocks")
+	writeTestFile(t, filepath.Join(root, "state", "shared_memory.bin"), "state")
+
+	manifest, err := NewManifestFromDirectory(root)
+	require.NoError(t, err)
+	require.Len(t, manifest.Files, 2)
+
+	assert.Equal(t, "blocks/blocks.log", manifest.Files[0].Path)
+	assert.Equal(t, int64(11), manifest.Files[0].Size)
+	assert.Equal(t, "state/shared_memory.bin", manifest.Files[1].Path)
+
+	same, err := NewManifestFromDirectory(root)
+	require.NoError(t, err)
+	require.NoError(t, manifest.Compare(same))
+
+	writeTestFile(t, filepath.Join(root, "state", "shared_memory.bin"), "STATE")
+	writeTestFile(t, filepath.Join(root, "extra"), "extra")
+	require.NoError(t, os.Remove(filepath.Join(root, "blocks", "blocks.log")))
+
+	changed, err := NewManifestFromDirectory(root)
+	require.NoError(t, err)
+
+	err = manifest.Compare(changed)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), `missing file "blocks/blocks.log"`), err.Error())
+	assert.True(t, strings.Contains(err.Error(), `file "state/shared_memory.bin" checksum`), err.Error())
+	assert.True(t, strings.Contains(err.Error(), `unexpected file "extra"`), err.Error())
+}
+
+func TestManifest_WriteRead(t *testing.T) {
+	store, err := dstore.NewStore("file://"+t.TempDir(), "", "", false)
+	require.NoError(t, err)
+
+	manifest := &BackupManifest{BackupName: "0000001000", BlockNum: 1000}
+	require.NoError(t, manifest.AddFile("a", strings.NewReader("content")))
+	require.NoError(t, WriteManifest(context.Background(), store, manifest))
+
+	read, err := ReadManifest(context.Background(), store, "0000001000")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000), read.BlockNum)
+	require.NoError(t, manifest.Compare(read))
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
@@ -24,10 +24,10 @@ import (
 
 	"github.com/streamingfast/derr"
 	nodeManager "github.com/streamingfast/node-manager"
+	"github.com/streamingfast/node-manager/metrics"
 	"github.com/streamingfast/shutter"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 type Operator struct {
@@ -35,17 +35,41 @@ type Operator struct {
 	options          *Options
 	lastStartCommand time.Time
 
-	backupModules   map[string]BackupModule
-	backupSchedules []*BackupSchedule
+	backupModules     map[string]BackupModule
+	backupSchedules   []*BackupSchedule
+	retentionPolicies map[string]*RetentionPolicy
 
-	commandChan chan *Command
-	httpServer  *http.Server
+	launchedSchedules     []*launchedSchedule
+	launchedSchedulesLock sync.Mutex
+
+	commandQueue   *commandQueue
+	commandHistory *commandHistory
+	httpServer     *http.Server
 
 	Superviser     nodeManager.ChainSuperviser
 	chainReadiness nodeManager.Readiness
 
+	restartTracker *restartTracker
+
+	journal               *Journal
+	journalLock           sync.Mutex
+	interruptedOperations []*JournalEntry
+
+	// currentCommand is the command being run by the operator loop
+	currentCommand     *Command
+	currentCommandLock sync.Mutex
+
+	// pendingRollback is armed by the last reload that swapped the command, it is only
+	// accessed by the operator loop
+	pendingRollback *reloadRollback
+
 	aboutToStop *atomic.Bool
-	zlogger     *zap.Logger
+	// launched is set while the operator loop runs, expectRunning while the process
+	// is not stopped on purpose and recovering while an unexpected stop is handled
+	launched      *atomic.Bool
+	expectRunning *atomic.Bool
+	recovering    *atomic.Bool
+	zlogger       *zap.Logger
 }
 
 type Bootstrapper interface {
@@ -53,26 +77,71 @@ type Bootstrapper interface {
 }
 
 type Options struct {
-	Bootstrapper Bootstrapper
+	Bootstrapper    Bootstrapper
+	RecoveryHandler RecoveryHandler
 
 	EnableSupervisorMonitoring bool
 
 	// Delay before sending Stop() to superviser, during which we return NotReady
 	ShutdownDelay time.Duration
-}
 
-type Command struct {
-	cmd      string
-	params   map[string]string
-	returnch chan error
-	closer   sync.Once
-	logger   *zap.Logger
-}
+	// RestartPolicy restarts the process in place when it stops on its own, when nil the operator shuts down
+	RestartPolicy *RestartPolicy
 
-func (c *Command) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
-	encoder.AddString("name", c.cmd)
-	encoder.AddReflected("params", c.params)
-	return nil
+	// Amount of commands kept in memory for status polling, defaults to 100 when 0
+	CommandHistorySize int
+
+	// Amount of commands waiting to be run, further commands are rejected, defaults to 10 when 0
+	CommandQueueSize int
+
+	// JournalPath is the file where backup and restore operations are journaled, when
+	// set, operations interrupted by a crash are handled on startup following JournalPolicy
+	JournalPath   string
+	JournalPolicy JournalPolicy
+
+	// BackupLease, when set, must be acquired before performing a scheduled backup so only one of
+	// the node-managers sharing it backs up at a time, others skip their scheduled backup.
+	// BackupLeaseTTL defaults to 5 minutes, the lease is renewed while the backup is running and
+	// kept for one more TTL once it completed. Set it to the schedule period so a single
+	// node-manager backs up per period, schedules of different node-managers are not aligned.
+	BackupLease    Lease
+	BackupLeaseTTL time.Duration
+
+	// MaxUploaderBacklog marks the node as not ready while more one block files than this are
+	// waiting to be uploaded, 0 disables the check
+	MaxUploaderBacklog int
+
+	// HeadBlockSource and UploaderBacklogSource complete the status and readiness of the
+	// node with the head block and uploader state, either can be nil
+	HeadBlockSource       HeadBlockSource
+	UploaderBacklogSource UploaderBacklogSource
+
+	// HTTPShutdownTimeout is how long in-flight HTTP requests are waited for on shutdown, defaults to 10s
+	HTTPShutdownTimeout time.Duration
+
+	// HTTPTLS serves the operator HTTP server over TLS when set
+	HTTPTLS *TLSConfig
+
+	// CommandLoader provides the command to run on reloads requesting the configuration
+	// to be read again, like `NewFileCommandLoader`
+	CommandLoader CommandLoader
+
+	// CommandStatePath is the file the command swapped by reloads is saved to, it is
+	// restored when the operator launches so a manager restart keeps running it
+	CommandStatePath string
+
+	// ReloadRollbackWindow, when a reload swaps the command, restores the previous command
+	// if the new one exits within that delay, 0 disables the rollback
+	ReloadRollbackWindow time.Duration
+
+	// ConfigChangeCheckInterval is how often the configuration files rendered by the
+	// superviser are checked for changes, a reload is queued when they would change.
+	// 0 disables the check.
+	ConfigChangeCheckInterval time.Duration
+
+	// CommandTimeouts bounds the running time of commands by name (e.g. "backup"), commands
+	// without a timeout run until completion or until canceled
+	CommandTimeouts map[string]time.Duration
 }
 
 func New(zlogger *zap.Logger, chainSuperviser nodeManager.ChainSuperviser, chainReadiness nodeManager.Readiness, options *Options) (*Operator, error) {
@@ -81,10 +150,15 @@ func New(zlogger *zap.Logger, chainSuperviser nodeManager.ChainSuperviser, chain
 	o := &Operator{
 		Shutter:        shutter.New(),
 		chainReadiness: chainReadiness,
-		commandChan:    make(chan *Command, 10),
+		commandQueue:   newCommandQueue(options.CommandQueueSize),
+		commandHistory: newCommandHistory(options.CommandHistorySize),
 		options:        options,
 		Superviser:     chainSuperviser,
+		restartTracker: newRestartTracker(options.RestartPolicy),
 		aboutToStop:    atomic.NewBool(false),
+		launched:       atomic.NewBool(false),
+		expectRunning:  atomic.NewBool(false),
+		recovering:     atomic.NewBool(false),
 		zlogger:        zlogger,
 	}
 
@@ -111,9 +185,17 @@ func New(zlogger *zap.Logger, chainSuperviser nodeManager.ChainSuperviser, chain
 }
 
 func (o *Operator) Launch(httpListenAddr string, options ...HTTPOption) error {
+	o.launched.Store(true)
+	defer o.launched.Store(false)
+
 	o.zlogger.Info("launching operator HTTP server", zap.String("http_listen_addr", httpListenAddr))
 	o.httpServer = o.RunHTTPServer(httpListenAddr, options...)
 
+	// Registered after the superviser shutdown, in-flight commands are settled by then
+	o.OnTerminating(func(_ error) {
+		o.shutdownHTTPServer()
+	})
+
 	// FIXME: too many options for that, maybe use monitoring module like with bootstrapper
 	if o.options.EnableSupervisorMonitoring {
 		if monitorable, ok := o.Superviser.(nodeManager.MonitorableChainSuperviser); ok {
@@ -123,6 +205,16 @@ func (o *Operator) Launch(httpListenAddr string, options ...HTTPOption) error {
 
 	o.LaunchBackupSchedules()
 
+	if o.options.ConfigChangeCheckInterval > 0 {
+		if renderer, ok := o.Superviser.(nodeManager.ConfigRenderingChainSuperviser); ok {
+			go o.reloadOnConfigChange(renderer, o.options.ConfigChangeCheckInterval)
+		}
+	}
+
+	if err := o.restoreCommandSpec(); err != nil {
+		return fmt.Errorf("unable to restore swapped command: %w", err)
+	}
+
 	if o.options.Bootstrapper != nil {
 		o.zlogger.Info("operator calling bootstrap function")
 		err := o.options.Bootstrapper.Bootstrap()
@@ -130,38 +222,100 @@ func (o *Operator) Launch(httpListenAddr string, options ...HTTPOption) error {
 			return fmt.Errorf("unable to bootstrap chain: %w", err)
 		}
 	}
-	o.commandChan <- &Command{cmd: "start", logger: o.zlogger}
 
+	startAllowed, err := o.replayJournal()
+	if err != nil {
+		return fmt.Errorf("unable to replay journal: %w", err)
+	}
+
+	if startAllowed {
+		if _, err := o.enqueue(o.newCommand("start", nil)); err != nil {
+			return fmt.Errorf("unable to queue start command: %w", err)
+		}
+	}
+
+	// restartDue fires once the backoff of a restart scheduled after an unexpected stop
+	// elapsed, commands keep being run meanwhile. handledStop is the stopped channel of
+	// the process execution the restart was scheduled for.
+	var restartDue <-chan time.Time
+	var handledStop <-chan struct{}
 	for {
 		o.zlogger.Info("operator ready to receive commands")
+
+		// The stopped channel stays closed until the process starts again, the shutdown
+		// is then watched directly
+		stopped, terminating := o.Superviser.Stopped(), (<-chan struct{})(nil)
+		if stopped != nil && stopped == handledStop {
+			stopped, terminating = nil, o.Terminating()
+		}
+
 		select {
-		case <-o.Superviser.Stopped(): // the chain stopped outside of a command that was expecting it.
+		case <-stopped: // the chain stopped outside of a command that was expecting it.
 			if o.Superviser.IsTerminating() {
 				o.zlogger.Info("superviser terminating, waiting for operator...")
 				<-o.Terminating()
 				return o.Err()
 			}
-			// FIXME call a restore handler if passed...
-			lastLogLines := o.Superviser.LastLogLines()
-
-			// FIXME: Actually, we should create a custom error type that contains the required data, the catching
-			//        code can thus perform the required formatting!
-			baseFormat := "instance %q stopped (exit code: %d), shutting down"
-			var shutdownErr error
-			if len(lastLogLines) > 0 {
-				shutdownErr = fmt.Errorf(baseFormat+": last log lines:\n%s", o.Superviser.GetName(), o.Superviser.LastExitCode(), formatLogLines(lastLogLines))
-			} else {
-				shutdownErr = fmt.Errorf(baseFormat, o.Superviser.GetName(), o.Superviser.LastExitCode())
+			if o.rollBackReload(stopped) {
+				continue
 			}
 
-			o.Shutdown(shutdownErr)
-			break
+			o.recovering.Store(true)
+			charge := o.chargeRestartBudget()
+			recovered, err := o.recoverAfterUnexpectedStop(charge)
+			if err != nil {
+				o.recovering.Store(false)
+				o.Shutdown(err)
+				break
+			}
+
+			if recovered {
+				o.recovering.Store(false)
+				continue
+			}
+
+			delay, scheduled := o.scheduleRestart(charge)
+			if !scheduled {
+				o.recovering.Store(false)
+				o.Shutdown(o.processStoppedError())
+				break
+			}
+
+			handledStop = stopped
+			restartDue = time.After(delay)
+
+		case <-restartDue:
+			restartDue = nil
+			restarted := o.restartAfterBackoff()
+			o.recovering.Store(false)
+			if !restarted {
+				o.Shutdown(o.processStoppedError())
+			}
+
+		case <-terminating:
+			o.zlogger.Info("operator terminating while process is stopped")
+			<-o.Superviser.Terminated()
+			return o.Err()
+
+		case <-o.commandQueue.ready():
+			cmd := o.commandQueue.pop()
+			if cmd == nil {
+				continue
+			}
 
-		case cmd := <-o.commandChan:
 			if cmd.cmd == "start" { // start 'sub' commands after a restore do NOT come through here
 				o.lastStartCommand = time.Now()
 			}
+			if err := cmd.contextError(); err != nil {
+				o.zlogger.Info("dropping command canceled while queued", zap.Object("command", cmd))
+				cmd.Return(err)
+				continue
+			}
+
+			cmd.markRunning()
+			o.setCurrentCommand(cmd)
 			err := o.runCommand(cmd)
+			o.setCurrentCommand(nil)
 			cmd.Return(err)
 			if err != nil {
 				if err == ErrCleanExit {
@@ -173,6 +327,105 @@ func (o *Operator) Launch(httpListenAddr string, options ...HTTPOption) error {
 	}
 }
 
+func (o *Operator) processStoppedError() *ProcessStoppedError {
+	err := &ProcessStoppedError{
+		Instance:     o.Superviser.GetName(),
+		ExitCode:     o.Superviser.LastExitCode(),
+		LastLogLines: o.Superviser.LastLogLines(),
+	}
+
+	if reporter, ok := o.Superviser.(nodeManager.ExitStatusChainSuperviser); ok {
+		if status := reporter.LastExitStatus(); status != nil {
+			err.PID = status.PID
+			err.Signal = status.Signal
+			err.Runtime = status.Runtime
+		}
+	}
+
+	return err
+}
+
+// restartCharge is the restart budget charged once per unexpected stop, whether the
+// process is then recovered or restarted. err is set when the budget could not be charged.
+type restartCharge struct {
+	delay time.Duration
+	err   error
+}
+
+// chargeRestartBudget charges the restart budget for the process that stopped on its
+// own, nothing is charged when no restart policy is configured.
+func (o *Operator) chargeRestartBudget() *restartCharge {
+	if !o.restartTracker.configured() {
+		return &restartCharge{err: fmt.Errorf("no restart policy configured")}
+	}
+
+	delay, err := o.restartTracker.charge(time.Now())
+	if err != nil {
+		return &restartCharge{err: err}
+	}
+
+	inWindow, _ := o.restartTracker.count()
+	metrics.ProcessRestartsInWindow.SetInt(inWindow, o.Superviser.GetName())
+
+	return &restartCharge{delay: delay}
+}
+
+// scheduleRestart applies the restart policy to the process that stopped on its
+// own, the budget being already charged for that stop. It returns the backoff delay
+// to wait before restarting it or false when the operator should shut down instead.
+func (o *Operator) scheduleRestart(charge *restartCharge) (time.Duration, bool) {
+	name := o.Superviser.GetName()
+	exitCode := o.Superviser.LastExitCode()
+
+	err := charge.err
+	if err == nil && !o.options.RestartPolicy.isRetryable(exitCode) {
+		err = fmt.Errorf("exit code %d is not retryable", exitCode)
+	}
+
+	if err != nil {
+		if o.options.RestartPolicy != nil {
+			o.zlogger.Warn("not restarting process that stopped on its own", zap.String("instance", name), zap.Int("exit_code", exitCode), zap.Error(err))
+		}
+		return 0, false
+	}
+
+	inWindow, total := o.restartTracker.count()
+	o.zlogger.Warn("process stopped on its own, restarting it after backoff",
+		zap.String("instance", name),
+		zap.Int("exit_code", exitCode),
+		zap.Duration("backoff", charge.delay),
+		zap.Int("restarts_in_window", inWindow),
+		zap.Int("restarts_total", total),
+	)
+
+	return charge.delay, true
+}
+
+// restartAfterBackoff restarts the process once the backoff of a scheduled restart
+// elapsed, unless a command started it or stopped it on purpose meanwhile. It
+// returns false when the operator should shut down instead.
+func (o *Operator) restartAfterBackoff() bool {
+	name := o.Superviser.GetName()
+
+	if o.Superviser.IsRunning() {
+		o.zlogger.Info("process already started during restart backoff", zap.String("instance", name))
+		return true
+	}
+
+	if !o.expectRunning.Load() {
+		o.zlogger.Info("process stopped on purpose during restart backoff, not restarting it", zap.String("instance", name))
+		return true
+	}
+
+	if err := o.Superviser.Start(); err != nil {
+		o.zlogger.Error("unable to restart process", zap.String("instance", name), zap.Error(err))
+		return false
+	}
+
+	metrics.ProcessRestarts.Inc(name)
+	return true
+}
+
 func formatLogLines(lines []string) string {
 	formattedLines := make([]string, len(lines))
 	for i, line := range lines {
@@ -183,10 +436,31 @@ func formatLogLines(lines []string) string {
 }
 
 func (o *Operator) runSubCommand(name string, parentCmd *Command) error {
-	return o.runCommand(&Command{cmd: name, returnch: parentCmd.returnch, logger: o.zlogger})
+	subCmd := &Command{id: parentCmd.id, cmd: name, parent: parentCmd, logger: o.zlogger}
+	o.journalRecord(JournalEventSubCommand, subCmd, nil)
+
+	return o.runCommand(subCmd)
+}
+
+func (o *Operator) setCurrentCommand(cmd *Command) {
+	o.currentCommandLock.Lock()
+	defer o.currentCommandLock.Unlock()
+
+	o.currentCommand = cmd
+}
+
+// runningCommand returns the command being run by the operator loop, nil when idle
+func (o *Operator) runningCommand() *Command {
+	o.currentCommandLock.Lock()
+	defer o.currentCommandLock.Unlock()
+
+	return o.currentCommand
 }
 
 func (o *Operator) cleanSuperviserStop() error {
+	// Stopping on purpose settles the last reload, its process did not stop on its own
+	o.pendingRollback = nil
+	o.expectRunning.Store(false)
 	o.aboutToStop.Store(true)
 	defer o.aboutToStop.Store(false)
 	if o.options.ShutdownDelay != 0 && !derr.IsShuttingDown() {
@@ -198,9 +472,31 @@ func (o *Operator) cleanSuperviserStop() error {
 	return err
 }
 
+// abortCommand settles a backup or restore aborted through its context, the
+// journaled operation is acknowledged since the module left the data usable and
+// the node is restarted if it was stopped for the operation.
+func (o *Operator) abortCommand(cmd *Command, mod BackupModule, abortErr error) error {
+	o.zlogger.Warn("command aborted", zap.Object("command", cmd), zap.Error(abortErr))
+	o.journalRecord(JournalEventAcknowledged, cmd, abortErr)
+
+	if mod.RequiresStop() {
+		o.zlogger.Info("Restarting after aborted command")
+		if err := o.runSubCommand("start", cmd); err != nil {
+			return err
+		}
+	}
+
+	cmd.Return(abortErr)
+	return nil
+}
+
 // runCommand does its work, and returns an error for irrecoverable states.
 func (o *Operator) runCommand(cmd *Command) error {
 	o.zlogger.Info("received operator command", zap.String("command", cmd.cmd), zap.Reflect("params", cmd.params))
+	if o.refuseWhileInterrupted(cmd) {
+		return nil
+	}
+
 	switch cmd.cmd {
 	case "maintenance":
 		o.zlogger.Info("preparing to stop process")
@@ -219,26 +515,59 @@ func (o *Operator) runCommand(cmd *Command) error {
 			return nil
 		}
 
-		o.zlogger.Info("Stopping to restore a backup")
+		backupName, err := resolveRestoreBackupName(restoreMod, cmd.params)
+		if err != nil {
+			cmd.Return(err)
+			return nil
+		}
+
+		if cmd.params["forceVerify"] == "true" {
+			verifiable, ok := restoreMod.(VerifiableBackupModule)
+			if !ok {
+				cmd.Return(fmt.Errorf("backup module does not support verification, cannot honor forceVerify"))
+				return nil
+			}
+
+			o.zlogger.Info("verifying backup before restoring it", zap.String("backup_name", backupName))
+			if err := verifiable.Verify(cmd.Context(), backupName); err != nil {
+				cmd.Return(fmt.Errorf("backup %q failed verification, not restoring it: %w", backupName, err))
+				return nil
+			}
+		}
+
+		o.journalRecord(JournalEventStarted, cmd, nil)
+
+		o.zlogger.Info("Stopping to restore a backup", zap.String("backup_name", backupName))
 		if restoreMod.RequiresStop() {
 			if err := o.cleanSuperviserStop(); err != nil {
+				o.journalRecord(JournalEventFailed, cmd, err)
 				return err
 			}
 		}
 
-		backupName := "latest"
-		if b, ok := cmd.params["backupName"]; ok {
-			backupName = b
+		if err := restoreWithContext(cmd.Context(), restoreMod, backupName); err != nil {
+			o.journalRecord(JournalEventFailed, cmd, err)
+			if abortErr := cmd.contextError(); abortErr != nil {
+				return o.abortCommand(cmd, restoreMod, abortErr)
+			}
+			return err
 		}
 
-		if err := restoreMod.Restore(backupName); err != nil {
-			return err
+		// A successful restore supersedes any previously interrupted operation
+		if interrupted := o.pendingInterruptedOperations(); len(interrupted) > 0 {
+			if err := o.acknowledgeInterrupted(interrupted, fmt.Sprintf("superseded by restore %s", cmd.id)); err != nil {
+				return err
+			}
 		}
 
 		o.zlogger.Info("Restarting after restore")
 		if restoreMod.RequiresStop() {
-			return o.runSubCommand("start", cmd)
+			if err := o.runSubCommand("start", cmd); err != nil {
+				return err
+			}
 		}
+
+		o.journalRecord(JournalEventCompleted, cmd, nil)
 		return nil
 
 	case "backup":
@@ -248,33 +577,115 @@ func (o *Operator) runCommand(cmd *Command) error {
 			return nil
 		}
 
+		if cmd.scheduled && o.options.BackupLease != nil {
+			finish, holder, err := o.acquireBackupLease()
+			if err != nil {
+				cmd.Return(err)
+				return nil
+			}
+
+			if finish == nil {
+				o.zlogger.Info("skipping scheduled backup, backup lease is held by another instance", zap.Reflect("holder", holder))
+				cmd.setResult(map[string]interface{}{"skipped": true, "lease_holder": holder})
+				return nil
+			}
+			defer finish()
+		}
+
+		o.journalRecord(JournalEventStarted, cmd, nil)
+
 		o.zlogger.Info("Stopping to perform a backup")
 		if backupMod.RequiresStop() {
 			if err := o.cleanSuperviserStop(); err != nil {
+				o.journalRecord(JournalEventFailed, cmd, err)
 				return err
 			}
 		}
 
-		backupName, err := backupMod.Backup(uint32(o.Superviser.LastSeenBlockNum()))
+		backupName, err := backupWithContext(cmd.Context(), backupMod, uint32(o.Superviser.LastSeenBlockNum()))
 		if err != nil {
+			o.journalRecord(JournalEventFailed, cmd, err)
+			if abortErr := cmd.contextError(); abortErr != nil {
+				return o.abortCommand(cmd, backupMod, abortErr)
+			}
 			return err
 		}
 		cmd.logger.Info("Completed backup", zap.String("backup_name", backupName))
 
 		o.zlogger.Info("Restarting after backup")
 		if backupMod.RequiresStop() {
-			return o.runSubCommand("start", cmd)
+			if err := o.runSubCommand("start", cmd); err != nil {
+				return err
+			}
+		}
+
+		o.journalRecord(JournalEventCompleted, cmd, nil)
+
+		if cmd.scheduled {
+			o.pruneBackups(cmd.params["name"], backupMod)
 		}
 		return nil
 
-	case "reload":
-		o.zlogger.Info("preparing for reload")
-		if err := o.cleanSuperviserStop(); err != nil {
+	case "verify":
+		restoreMod, err := selectRestoreModule(o.backupModules, cmd.params["name"])
+		if err != nil {
+			cmd.Return(err)
+			return nil
+		}
+
+		verifiable, ok := restoreMod.(VerifiableBackupModule)
+		if !ok {
+			cmd.Return(fmt.Errorf("backup module does not support verification"))
+			return nil
+		}
+
+		backupName, err := resolveRestoreBackupName(restoreMod, cmd.params)
+		if err != nil {
+			cmd.Return(err)
+			return nil
+		}
+
+		o.zlogger.Info("verifying backup", zap.String("backup_name", backupName))
+		if err := verifiable.Verify(cmd.Context(), backupName); err != nil {
+			cmd.Return(fmt.Errorf("backup %q failed verification: %w", backupName, err))
+			return nil
+		}
+
+		o.zlogger.Info("backup successfully verified", zap.String("backup_name", backupName))
+		cmd.setResult(map[string]string{"backup_name": backupName})
+
+	case "list":
+		offset, limit, err := parsePagination(cmd.params)
+		if err != nil {
+			cmd.Return(err)
+			return nil
+		}
+
+		listing, err := listBackups(o.backupModules, cmd.params["name"], offset, limit)
+		if err != nil {
+			cmd.Return(err)
+			return nil
+		}
+
+		cmd.setResult(listing)
+
+	case "acknowledge_interrupted":
+		interrupted := o.pendingInterruptedOperations()
+		if len(interrupted) == 0 {
+			o.zlogger.Info("no interrupted operations to acknowledge")
+			return nil
+		}
+
+		o.zlogger.Info("acknowledging interrupted operations", zap.Int("count", len(interrupted)))
+		if err := o.acknowledgeInterrupted(interrupted, fmt.Sprintf("acknowledged by %s", cmd.id)); err != nil {
 			return err
 		}
 
 		return o.runSubCommand("start", cmd)
 
+	case "reload":
+		return o.reload(cmd)
+
 	case "safely_resume_production":
 		o.zlogger.Info("preparing for safely resume production")
 		producer, ok := o.Superviser.(nodeManager.ProducerChainSuperviser)
@@ -353,22 +764,28 @@ func (o *Operator) runCommand(cmd *Command) error {
 		}
 
 		o.zlogger.Info("issuing 'reload' now")
-		emptied := false
-		for !emptied {
-			select {
-			case interimCmd := <-o.commandChan:
-				o.zlogger.Info("emptying command queue while safely_reload was running, dropped", zap.Any("interim_cmd", interimCmd))
-			default:
-				emptied = true
-			}
+		var dropped []string
+		for _, interimCmd := range o.commandQueue.drain() {
+			o.zlogger.Info("emptying command queue while safely_reload was running, dropped", zap.Object("interim_cmd", interimCmd))
+			interimCmd.Return(fmt.Errorf("dropped by %q command %s", cmd.cmd, cmd.id))
+			dropped = append(dropped, interimCmd.id)
+		}
+		if len(dropped) > 0 {
+			cmd.setResult(map[string][]string{"dropped_commands": dropped})
 		}
 
 		return o.runSubCommand("reload", cmd)
 
 	case "start", "resume":
 		o.zlogger.Info("preparing for start")
+		if interrupted := o.pendingInterruptedOperations(); len(interrupted) > 0 {
+			cmd.Return(fmt.Errorf("refusing to start, %d interrupted operation(s) found in journal must be acknowledged first", len(interrupted)))
+			return nil
+		}
+
 		if o.Superviser.IsRunning() {
 			o.zlogger.Info("chain is already running")
+			o.expectRunning.Store(true)
 			return nil
 		}
 
@@ -386,6 +803,7 @@ func (o *Operator) runCommand(cmd *Command) error {
 		if err := o.Superviser.Start(options...); err != nil {
 			return fmt.Errorf("error starting chain superviser: %w", err)
 		}
+		o.expectRunning.Store(true)
 
 		o.zlogger.Info("successfully start service")
 
@@ -394,18 +812,6 @@ func (o *Operator) runCommand(cmd *Command) error {
 	return nil
 }
 
-func (c *Command) Return(err error) {
-	c.closer.Do(func() {
-		if err != nil && err != ErrCleanExit {
-			c.logger.Error("command failed", zap.String("cmd", c.cmd), zap.Error(err))
-		}
-
-		if c.returnch != nil {
-			c.returnch <- err
-		}
-	})
-}
-
 func (o *Operator) LaunchBackupSchedules() {
 	for _, sched := range o.backupSchedules {
 		if sched.RequiredHostnameMatch != "" {
@@ -423,6 +829,18 @@ func (o *Operator) LaunchBackupSchedules() {
 			}
 		}
 
+		if sched.Retention != nil {
+			if o.retentionPolicies == nil {
+				o.retentionPolicies = make(map[string]*RetentionPolicy)
+			}
+			o.retentionPolicies[sched.BackuperName] = sched.Retention
+		}
+
+		launched := &launchedSchedule{BackupSchedule: sched}
+		o.launchedSchedulesLock.Lock()
+		o.launchedSchedules = append(o.launchedSchedules, launched)
+		o.launchedSchedulesLock.Unlock()
+
 		cmdParams := map[string]string{"name": sched.BackuperName}
 
 		if sched.TimeBetweenRuns > time.Second { //loose validation of not-zero (I've seen issues with .IsZero())
@@ -439,6 +857,14 @@ func (o *Operator) LaunchBackupSchedules() {
 			)
 			go o.RunEveryXBlock(uint32(sched.BlocksBetweenRuns), "backup", cmdParams)
 		}
+		if sched.Cron != nil {
+			o.zlogger.Info("starting cron-based schedule for backup",
+				zap.Stringer("cron", sched.Cron),
+				zap.Bool("skip_missed_run", sched.SkipMissedRun),
+				zap.String("backuper_name", sched.BackuperName),
+			)
+			go o.RunOnCron(launched)
+		}
 	}
 }
 
@@ -455,7 +881,7 @@ func (o *Operator) RunEveryPeriod(period time.Duration, commandName string, para
 
 	for range ticker {
 		if o.Superviser.IsRunning() {
-			o.commandChan <- &Command{cmd: commandName, logger: o.zlogger, params: params}
+			o.enqueueScheduled(commandName, params)
 		}
 	}
 }
@@ -474,7 +900,7 @@ func (o *Operator) RunEveryXBlock(freq uint32, commandName string, params map[st
 		}
 
 		if lastSeenBlockNum > lastHeadReference+uint64(freq) {
-			o.commandChan <- &Command{cmd: commandName, logger: o.zlogger, params: params}
+			o.enqueueScheduled(commandName, params)
 			lastHeadReference = lastSeenBlockNum
 		}
 	}
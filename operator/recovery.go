@@ -0,0 +1,116 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+
+	"github.com/streamingfast/node-manager/metrics"
+	"go.uber.org/zap"
+)
+
+// RecoveryHandler is called when the process stopped on its own, before the
+// restart policy is applied. Returning a nil `*Recovery` means no recovery is
+// needed, the restart policy (or shutdown) applies as usual. When a restart policy
+// is configured, recoveries count against its budget, none is performed once it is
+// exhausted, its exit codes do not apply to them.
+type RecoveryHandler interface {
+	Recover(exitCode int, lastLogLines []string) (*Recovery, error)
+}
+
+type RecoveryHandlerFunc func(exitCode int, lastLogLines []string) (*Recovery, error)
+
+func (f RecoveryHandlerFunc) Recover(exitCode int, lastLogLines []string) (*Recovery, error) {
+	return f(exitCode, lastLogLines)
+}
+
+// Recovery describes the backup to restore before restarting the process.
+type Recovery struct {
+	// BackupModule is the name of the registered `RestorableBackupModule` to restore
+	// from, can be left empty when a single restorable module is registered.
+	BackupModule string
+
+	// BackupName is the backup to restore, defaults to "latest"
+	BackupName string
+}
+
+func (r *Recovery) params() map[string]string {
+	params := map[string]string{}
+	if r.BackupModule != "" {
+		params["name"] = r.BackupModule
+	}
+	if r.BackupName != "" {
+		params["backupName"] = r.BackupName
+	}
+
+	return params
+}
+
+// recoverAfterUnexpectedStop asks the recovery handler what to do with the stopped
+// process and runs the requested restore, which restarts the process. It returns
+// false when no recovery was performed, `charge` then applies to the restart.
+func (o *Operator) recoverAfterUnexpectedStop(charge *restartCharge) (recovered bool, err error) {
+	if o.options.RecoveryHandler == nil {
+		return false, nil
+	}
+
+	name := o.Superviser.GetName()
+	exitCode := o.Superviser.LastExitCode()
+
+	recovery, err := o.options.RecoveryHandler.Recover(exitCode, o.Superviser.LastLogLines())
+	if err != nil {
+		o.zlogger.Error("recovery handler failed, not recovering", zap.String("instance", name), zap.Int("exit_code", exitCode), zap.Error(err))
+		return false, nil
+	}
+
+	if recovery == nil {
+		o.zlogger.Info("recovery handler decided not to recover", zap.String("instance", name), zap.Int("exit_code", exitCode))
+		return false, nil
+	}
+
+	if o.restartTracker.configured() && charge.err != nil {
+		o.zlogger.Warn("not recovering process that stopped on its own", zap.String("instance", name), zap.Int("exit_code", exitCode), zap.Error(charge.err))
+		return false, nil
+	}
+
+	inWindow, _ := o.restartTracker.count()
+
+	cmd := o.newCommand("restore", recovery.params())
+	o.zlogger.Warn("process stopped on its own, recovering from backup", zap.String("instance", name), zap.Int("exit_code", exitCode), zap.Int("restarts_in_window", inWindow), zap.Object("command", cmd))
+
+	cmd.markRunning()
+	o.setCurrentCommand(cmd)
+	err = o.runCommand(cmd)
+	o.setCurrentCommand(nil)
+	cmd.Return(err)
+	if err != nil {
+		return false, fmt.Errorf("recovery restore failed: %w", err)
+	}
+
+	if status := cmd.Status(); status.State == CommandStateFailed {
+		o.zlogger.Error("recovery restore did not complete", zap.String("instance", name), zap.String("error", status.Error))
+		return false, nil
+	}
+
+	// Modules not requiring a stop do not restart the process themselves after the restore
+	if !o.Superviser.IsRunning() {
+		if err := o.Superviser.Start(); err != nil {
+			return false, fmt.Errorf("unable to restart process after recovery: %w", err)
+		}
+	}
+
+	metrics.ProcessRestarts.Inc(name)
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+type testRecoveryModule struct {
+	onRestore func()
+	restores  atomic.Int32
+}
+
+func (m *testRecoveryModule) Backup(_ uint32) (string, error) { return "", nil }
+func (m *testRecoveryModule) RequiresStop() bool              { return false }
+func (m *testRecoveryModule) Restore(_ string) error {
+	m.restores.Inc()
+	m.onRestore()
+	return nil
+}
+
+func TestOperator_RecoveryCountsAgainstRestartBudget(t *testing.T) {
+	superviser := newCrashingSuperviser()
+	o, err := New(zap.NewNop(), superviser, testReadiness(true), &Options{
+		RestartPolicy: &RestartPolicy{MaxRestarts: 1, InitialBackoff: time.Hour},
+		RecoveryHandler: RecoveryHandlerFunc(func(_ int, _ []string) (*Recovery, error) {
+			return &Recovery{BackupName: "0000000001"}, nil
+		}),
+	})
+	require.NoError(t, err)
+
+	var restoreID string
+	var reasonsDuringRestore []*NotReadyReason
+	module := &testRecoveryModule{onRestore: func() {
+		restoreID = o.runningCommand().id
+		reasonsDuringRestore = o.notReadyReasons()
+	}}
+	require.NoError(t, o.RegisterBackupModule("test", module))
+
+	go o.Launch("127.0.0.1:0")
+
+	require.Eventually(t, func() bool { return superviser.startCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+	superviser.crash()
+	require.Eventually(t, func() bool { return superviser.startCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 1, module.restores.Load())
+	assert.Contains(t, reasonsDuringRestore, &NotReadyReason{NotReadyRestoring, "restore " + restoreID + " in progress"})
+
+	superviser.crash()
+	select {
+	case <-o.Terminated():
+	case <-time.After(5 * time.Second):
+		t.Fatal("operator did not shut down once the restart budget was exhausted")
+	}
+
+	assert.EqualValues(t, 1, module.restores.Load(), "budget exhausted, not recovering again")
+	assert.IsType(t, &ProcessStoppedError{}, o.Err())
+}
+
+func TestOperator_RecoveryWithoutRestartPolicy(t *testing.T) {
+	superviser := newCrashingSuperviser()
+	o, err := New(zap.NewNop(), superviser, testReadiness(true), &Options{
+		RecoveryHandler: RecoveryHandlerFunc(func(_ int, _ []string) (*Recovery, error) {
+			return &Recovery{BackupName: "0000000001"}, nil
+		}),
+	})
+	require.NoError(t, err)
+
+	module := &testRecoveryModule{onRestore: func() {}}
+	require.NoError(t, o.RegisterBackupModule("test", module))
+
+	go o.Launch("127.0.0.1:0")
+	defer o.Shutdown(nil)
+
+	require.Eventually(t, func() bool { return superviser.startCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+	superviser.crash()
+	require.Eventually(t, func() bool { return superviser.startCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 1, module.restores.Load())
+	assert.False(t, o.IsTerminating())
+}
+
+func TestOperator_FailedRecoveryChargesRestartBudgetOnce(t *testing.T) {
+	superviser := newCrashingSuperviser()
+	o, err := New(zap.NewNop(), superviser, testReadiness(true), &Options{
+		RestartPolicy: &RestartPolicy{MaxRestarts: 2, InitialBackoff: 10 * time.Millisecond},
+		RecoveryHandler: RecoveryHandlerFunc(func(_ int, _ []string) (*Recovery, error) {
+			return &Recovery{BackupModule: "missing"}, nil
+		}),
+	})
+	require.NoError(t, err)
+
+	go o.Launch("127.0.0.1:0")
+
+	require.Eventually(t, func() bool { return superviser.startCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+	superviser.crash()
+	require.Eventually(t, func() bool { return superviser.startCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+	superviser.crash()
+	require.Eventually(t, func() bool { return superviser.startCount() == 3 }, 5*time.Second, 10*time.Millisecond, "a failed recovery and its restart share one restart")
+
+	superviser.crash()
+	select {
+	case <-o.Terminated():
+	case <-time.After(5 * time.Second):
+		t.Fatal("operator did not shut down once the restart budget was exhausted")
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	nodeManager "github.com/streamingfast/node-manager"
+	"go.uber.org/zap"
+)
+
+// CommandLoader provides the command the process should run, it is called on
+// `reload` commands with the `reload_config` parameter, see `NewFileCommandLoader`.
+type CommandLoader interface {
+	LoadCommand() (*nodeManager.CommandSpec, error)
+}
+
+type fileCommandLoader struct {
+	path string
+}
+
+// NewFileCommandLoader reads the command from a JSON file, like `{"binary":
+// "/usr/local/bin/node", "arguments": ["--data-dir=/data"], "env": ["GOGC=50"]}`,
+// the file is read again on each reload. When `env` is omitted, the process
+// inherits the manager environment.
+func NewFileCommandLoader(path string) CommandLoader {
+	return &fileCommandLoader{path: path}
+}
+
+func (l *fileCommandLoader) LoadCommand() (*nodeManager.CommandSpec, error) {
+	content, err := os.ReadFile(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("read command file: %w", err)
+	}
+
+	spec := &nodeManager.CommandSpec{}
+	if err := json.Unmarshal(content, spec); err != nil {
+		return nil, fmt.Errorf("invalid command file %q: %w", l.path, err)
+	}
+
+	return spec, nil
+}
+
+// saveCommandSpec writes `spec` to `path` in the `NewFileCommandLoader` format, the
+// file is replaced atomically so a crash never leaves it half written
+func saveCommandSpec(path string, spec *nodeManager.CommandSpec) error {
+	content, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	if err := nodeManager.WriteFileAtomically(path, content, 0644); err != nil {
+		return fmt.Errorf("write command file: %w", err)
+	}
+
+	return nil
+}
+
+// restoreCommandSpec makes the superviser run the command saved by the last reload
+// that swapped it, the command it was created with is kept when none was saved
+func (o *Operator) restoreCommandSpec() error {
+	if o.options.CommandStatePath == "" {
+		return nil
+	}
+
+	swappable, ok := o.Superviser.(nodeManager.CommandSwappableChainSuperviser)
+	if !ok {
+		return fmt.Errorf("the chain superviser does not support swapping its command")
+	}
+
+	spec, err := NewFileCommandLoader(o.options.CommandStatePath).LoadCommand()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	o.zlogger.Info("restoring command swapped by a previous reload", zap.String("binary", spec.Binary), zap.Strings("arguments", spec.Arguments))
+	return swappable.SetCommandSpec(spec)
+}
+
+// persistCommandSpec saves `spec` so it is restored when the operator launches again
+func (o *Operator) persistCommandSpec(spec *nodeManager.CommandSpec) {
+	if o.options.CommandStatePath == "" {
+		return
+	}
+
+	if err := saveCommandSpec(o.options.CommandStatePath, spec); err != nil {
+		o.zlogger.Error("unable to save swapped command, a manager restart reverts it", zap.String("path", o.options.CommandStatePath), zap.Error(err))
+	}
+}
+
+// reloadRequest is the command swap requested through the parameters of a
+// `reload` command, the current command is kept when none of them are set:
+//   - `reload_config` set to "true" swaps the command to the one provided by the
+//     `CommandLoader`, the command can only come from the manager host
+//   - `rollback_window` overrides `Options.ReloadRollbackWindow`
+//
+// The `binary`, `arguments` and `env` parameters are no longer accepted and are
+// rejected: letting API callers choose the binary run by the manager is remote code
+// execution for anyone able to reload, the command to swap to must be deployed on
+// the manager host.
+type reloadRequest struct {
+	reloadConfig bool
+
+	rollbackWindow    time.Duration
+	hasRollbackWindow bool
+}
+
+var reloadParamNames = []string{"reload_config", "rollback_window"}
+
+// removedReloadParamNames set the command to swap to in earlier versions, see `reloadRequest`
+var removedReloadParamNames = []string{"binary", "arguments", "env"}
+
+func parseReloadRequest(params map[string]string) (*reloadRequest, error) {
+	req := &reloadRequest{}
+
+	for _, name := range removedReloadParamNames {
+		if _, found := params[name]; found {
+			return nil, fmt.Errorf("reload no longer accepts %q, the command is only swapped from the operator command loader through 'reload_config'", name)
+		}
+	}
+
+	if value := params["reload_config"]; value != "" {
+		req.reloadConfig = value == "true"
+	}
+
+	if value, found := params["rollback_window"]; found {
+		window, err := time.ParseDuration(value)
+		if err != nil || window < 0 {
+			return nil, fmt.Errorf("invalid rollback window %q, expecting a duration like '30s'", value)
+		}
+		req.rollbackWindow = window
+		req.hasRollbackWindow = true
+	}
+
+	return req, nil
+}
+
+func (r *reloadRequest) swapsCommand() bool {
+	return r.reloadConfig
+}
+
+// commandSpec loads the command to swap to and validates it against the superviser
+func (r *reloadRequest) commandSpec(swappable nodeManager.CommandSwappableChainSuperviser, loader CommandLoader) (*nodeManager.CommandSpec, error) {
+	if loader == nil {
+		return nil, fmt.Errorf("reload_config requested but no command loader is configured")
+	}
+
+	spec, err := loader.LoadCommand()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load command: %w", err)
+	}
+
+	if err := swappable.ValidateCommandSpec(spec); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// reloadParams returns the parameters of a `reload` command, which are the ones
+// of the parent command when it runs as a sub-command of `safely_reload`
+func reloadParams(cmd *Command) map[string]string {
+	if cmd.parent != nil {
+		return cmd.parent.params
+	}
+
+	return cmd.params
+}
+
+// reloadRollback is armed by a reload that swapped the command, the previous
+// command is restored if the process started by the reload stops before `deadline`
+type reloadRollback struct {
+	previous *nodeManager.CommandSpec
+	spec     *nodeManager.CommandSpec
+	stopped  <-chan struct{}
+	window   time.Duration
+	deadline time.Time
+}
+
+// reload restarts the process, swapping its command first when requested. The
+// reload completes once the new command started, when it stops on its own within
+// the rollback window, the operator loop restores the previous command and starts
+// it again, see `rollBackReload`.
+func (o *Operator) reload(cmd *Command) error {
+	o.zlogger.Info("preparing for reload")
+
+	req, err := parseReloadRequest(reloadParams(cmd))
+	if err != nil {
+		cmd.Return(err)
+		return nil
+	}
+
+	if !req.swapsCommand() {
+		if err := o.cleanSuperviserStop(); err != nil {
+			return err
+		}
+
+		return o.runSubCommand("start", cmd)
+	}
+
+	swappable, ok := o.Superviser.(nodeManager.CommandSwappableChainSuperviser)
+	if !ok {
+		cmd.Return(fmt.Errorf("the chain superviser does not support swapping its command"))
+		return nil
+	}
+
+	previous := swappable.CommandSpec()
+	spec, err := req.commandSpec(swappable, o.options.CommandLoader)
+	if err != nil {
+		cmd.Return(fmt.Errorf("refusing to reload: %w", err))
+		return nil
+	}
+
+	window := o.options.ReloadRollbackWindow
+	if req.hasRollbackWindow {
+		window = req.rollbackWindow
+	}
+
+	o.zlogger.Info("reloading with new command",
+		zap.String("previous_binary", previous.Binary),
+		zap.String("binary", spec.Binary),
+		zap.Strings("arguments", spec.Arguments),
+		zap.Duration("rollback_window", window),
+	)
+
+	if err := o.cleanSuperviserStop(); err != nil {
+		return err
+	}
+
+	if err := swappable.SetCommandSpec(spec); err != nil {
+		cmd.Return(fmt.Errorf("unable to swap command, restarting previous one: %w", err))
+		return o.runSubCommand("start", cmd)
+	}
+	o.persistCommandSpec(spec)
+
+	if err := o.runSubCommand("start", cmd); err != nil {
+		return err
+	}
+
+	// No process was started when the start sub-command refused to start it
+	if stopped := o.Superviser.Stopped(); window > 0 && stopped != nil {
+		o.pendingRollback = &reloadRollback{
+			previous: previous,
+			spec:     spec,
+			stopped:  stopped,
+			window:   window,
+			deadline: time.Now().Add(window),
+		}
+	}
+
+	return nil
+}
+
+// rollBackReload restores and starts the command a reload swapped when the process
+// it started stopped on its own within the rollback window. It returns false when
+// no rollback applies to `stopped`, the stop is then handled as any other.
+func (o *Operator) rollBackReload(stopped <-chan struct{}) bool {
+	rollback := o.pendingRollback
+	o.pendingRollback = nil
+	if rollback == nil || rollback.stopped != stopped || time.Now().After(rollback.deadline) {
+		return false
+	}
+
+	exitCode := o.Superviser.LastExitCode()
+	o.zlogger.Warn("new command exited within rollback window, rolling back to previous command",
+		zap.String("binary", rollback.spec.Binary),
+		zap.String("previous_binary", rollback.previous.Binary),
+		zap.Int("exit_code", exitCode),
+		zap.Duration("rollback_window", rollback.window),
+	)
+
+	swappable := o.Superviser.(nodeManager.CommandSwappableChainSuperviser)
+	if err := swappable.SetCommandSpec(rollback.previous); err != nil {
+		o.zlogger.Error("unable to roll back to previous command", zap.Error(err))
+		return false
+	}
+	o.persistCommandSpec(rollback.previous)
+
+	if err := o.Superviser.Start(); err != nil {
+		o.zlogger.Error("unable to start previous command", zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// reloadOnConfigChange queues a reload each time the configuration files of the
+// running process would change, the reload renders them again before starting it
+func (o *Operator) reloadOnConfigChange(renderer nodeManager.ConfigRenderingChainSuperviser, interval time.Duration) {
+	for {
+		select {
+		case <-o.Terminating():
+			return
+		case <-time.After(interval):
+		}
+
+		if !o.Superviser.IsRunning() {
+			continue
+		}
+
+		changed, err := renderer.PendingConfigChanges()
+		if err != nil {
+			o.zlogger.Warn("unable to check config for changes", zap.Error(err))
+			continue
+		}
+
+		if len(changed) > 0 {
+			o.zlogger.Info("config changed, queuing reload", zap.Strings("destinations", changed))
+			o.enqueueScheduled("reload", nil)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package operator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	nodeManager "github.com/streamingfast/node-manager"
+	"github.com/streamingfast/shutter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// testSwappableSuperviser runs its command instantly, the process exits right
+// away when the binary is `failingBinary`
+type testSwappableSuperviser struct {
+	testSuperviser
+
+	spec          *nodeManager.CommandSpec
+	failingBinary string
+	started       []string
+	stopped       chan struct{}
+}
+
+func (s *testSwappableSuperviser) Start(_ ...nodeManager.StartOption) error {
+	s.started = append(s.started, s.spec.Binary)
+	s.stopped = make(chan struct{})
+	s.running = true
+	if s.spec.Binary == s.failingBinary {
+		s.running = false
+		s.lastExitCode = 1
+		close(s.stopped)
+	}
+
+	return nil
+}
+
+func (s *testSwappableSuperviser) Stop() error {
+	s.running = false
+	return nil
+}
+
+func (s *testSwappableSuperviser) Stopped() <-chan struct{}              { return s.stopped }
+func (s *testSwappableSuperviser) CommandSpec() *nodeManager.CommandSpec { return s.spec }
+
+func (s *testSwappableSuperviser) ValidateCommandSpec(spec *nodeManager.CommandSpec) error {
+	return spec.Validate("")
+}
+
+func (s *testSwappableSuperviser) SetCommandSpec(spec *nodeManager.CommandSpec) error {
+	if err := s.ValidateCommandSpec(spec); err != nil {
+		return err
+	}
+
+	s.spec = spec
+	return nil
+}
+
+func TestParseReloadRequest(t *testing.T) {
+	req, err := parseReloadRequest(nil)
+	require.NoError(t, err)
+	assert.False(t, req.swapsCommand())
+
+	_, err = parseReloadRequest(map[string]string{"binary": "/bin/sh", "arguments": `["-c", "id"]`})
+	assert.Error(t, err, "command is only swapped from the command loader")
+
+	req, err = parseReloadRequest(map[string]string{"reload_config": "true", "rollback_window": "30s"})
+	require.NoError(t, err)
+	assert.True(t, req.swapsCommand())
+	assert.Equal(t, 30*time.Second, req.rollbackWindow)
+
+	_, err = parseReloadRequest(map[string]string{"rollback_window": "-1s"})
+	assert.Error(t, err)
+}
+
+func TestReloadRequest_CommandSpec(t *testing.T) {
+	dir := t.TempDir()
+	next := writeTestBinary(t, dir, "next", 0755)
+	writeTestBinary(t, dir, "not-executable", 0644)
+	swappable := &testSwappableSuperviser{}
+
+	configFile := filepath.Join(dir, "command.json")
+	writeCommandFile := func(content string) {
+		require.NoError(t, os.WriteFile(configFile, []byte(content), 0600))
+	}
+	req := &reloadRequest{reloadConfig: true}
+
+	writeCommandFile(`{"binary": "` + next + `", "arguments": ["--b"], "env": ["A=1"]}`)
+	spec, err := req.commandSpec(swappable, NewFileCommandLoader(configFile))
+	require.NoError(t, err)
+	assert.Equal(t, &nodeManager.CommandSpec{Binary: next, Arguments: []string{"--b"}, Env: []string{"A=1"}}, spec)
+
+	_, err = req.commandSpec(swappable, nil)
+	assert.Error(t, err)
+
+	for _, content := range []string{
+		`{"binary": "` + filepath.Join(dir, "not-executable") + `"}`,
+		`{"binary": "` + filepath.Join(dir, "missing") + `"}`,
+		`{"binary": "` + next + `", "env": ["A"]}`,
+		`{"binary": "./next"}`,
+	} {
+		writeCommandFile(content)
+		_, err = req.commandSpec(swappable, NewFileCommandLoader(configFile))
+		assert.Error(t, err, content)
+	}
+}
+
+func TestCommandSpec_ValidateRelativeToWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTestBinary(t, dir, "node", 0755)
+
+	spec := &nodeManager.CommandSpec{Binary: "./node"}
+	assert.NoError(t, spec.Validate(dir))
+	assert.Error(t, spec.Validate(t.TempDir()))
+}
+
+func TestOperator_ReloadSwapsCommand(t *testing.T) {
+	dir := t.TempDir()
+	current := writeTestBinary(t, dir, "current", 0755)
+	next := writeTestBinary(t, dir, "next", 0755)
+
+	configFile := filepath.Join(dir, "command.json")
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"binary": "`+next+`"}`), 0600))
+	statePath := filepath.Join(dir, "state.json")
+
+	superviser := &testSwappableSuperviser{spec: &nodeManager.CommandSpec{Binary: current}, failingBinary: next}
+	o := newTestReloadOperator(superviser)
+	o.options.CommandLoader = NewFileCommandLoader(configFile)
+	o.options.CommandStatePath = statePath
+
+	reload := o.newCommand("reload", map[string]string{"reload_config": "true", "rollback_window": "1m"})
+	require.NoError(t, o.runCommand(reload))
+	reload.Return(nil)
+	assert.Equal(t, CommandStateSucceeded, reload.Status().State, "reload does not wait for the rollback window")
+	assert.Equal(t, []string{next}, superviser.started)
+	assertSavedCommand(t, statePath, next)
+
+	assert.True(t, o.rollBackReload(superviser.stopped))
+	assert.Equal(t, []string{next, current}, superviser.started)
+	assert.Equal(t, current, superviser.spec.Binary)
+	assert.True(t, superviser.running)
+	assertSavedCommand(t, statePath, current)
+	assert.False(t, o.rollBackReload(superviser.stopped), "rollback only happens once")
+
+	superviser.failingBinary = ""
+	superviser.started = nil
+
+	reload = o.newCommand("reload", map[string]string{"reload_config": "true", "rollback_window": "10ms"})
+	require.NoError(t, o.runCommand(reload))
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, o.rollBackReload(superviser.stopped), "process stopped after the rollback window")
+	assert.Equal(t, []string{next}, superviser.started)
+	assert.Equal(t, next, superviser.spec.Binary)
+
+	restarted := newTestReloadOperator(&testSwappableSuperviser{spec: &nodeManager.CommandSpec{Binary: current}})
+	restarted.options.CommandStatePath = statePath
+	require.NoError(t, restarted.restoreCommandSpec())
+	assert.Equal(t, next, restarted.Superviser.(*testSwappableSuperviser).spec.Binary, "swapped command survives a manager restart")
+
+	superviser.started = nil
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"binary": "`+filepath.Join(dir, "missing")+`"}`), 0600))
+	reload = o.newCommand("reload", map[string]string{"reload_config": "true"})
+	require.NoError(t, o.runCommand(reload))
+	assert.Equal(t, CommandStateFailed, reload.Status().State)
+	assert.Empty(t, superviser.started, "process is not stopped when the new command is invalid")
+	assert.True(t, superviser.running)
+}
+
+func assertSavedCommand(t *testing.T, path, binary string) {
+	t.Helper()
+
+	spec, err := NewFileCommandLoader(path).LoadCommand()
+	require.NoError(t, err)
+	assert.Equal(t, binary, spec.Binary)
+}
+
+func newTestReloadOperator(superviser nodeManager.ChainSuperviser) *Operator {
+	return &Operator{
+		Shutter:        shutter.New(),
+		aboutToStop:    atomic.NewBool(false),
+		expectRunning:  atomic.NewBool(false),
+		options:        &Options{},
+		Superviser:     superviser,
+		commandQueue:   newCommandQueue(0),
+		commandHistory: newCommandHistory(0),
+		zlogger:        zap.NewNop(),
+	}
+}
+
+func writeTestBinary(t *testing.T, dir, name string, mode uint32) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0600))
+	require.NoError(t, os.Chmod(path, os.FileMode(mode)))
+	return path
+}
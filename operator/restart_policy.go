@@ -0,0 +1,156 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RestartPolicy controls how the operator restarts the supervised process when it
+// stops on its own. When no policy is configured, or when the restart budget is
+// exhausted, the operator shuts down.
+type RestartPolicy struct {
+	// MaxRestarts is the maximum number of restarts allowed within Window, 0 disables restarts
+	MaxRestarts int
+
+	// Window is the sliding period over which MaxRestarts is counted, 0 means for the whole process lifetime
+	Window time.Duration
+
+	// InitialBackoff is the delay before the first restart, it is multiplied by BackoffMultiplier
+	// for each restart already performed in the current Window, capped to MaxBackoff when set
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+
+	// Jitter is the fraction (between 0 and 1) of the computed backoff that is randomly added or removed
+	Jitter float64
+
+	// FatalExitCodes are never restarted. When RetryableExitCodes is non-empty, only those are restarted.
+	FatalExitCodes     []int
+	RetryableExitCodes []int
+}
+
+func (p *RestartPolicy) isRetryable(exitCode int) bool {
+	for _, code := range p.FatalExitCodes {
+		if code == exitCode {
+			return false
+		}
+	}
+
+	if len(p.RetryableExitCodes) == 0 {
+		return true
+	}
+
+	for _, code := range p.RetryableExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *RestartPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+
+	return time.Duration(delay)
+}
+
+// restartTracker keeps the restarts performed so far to enforce the restart budget
+// of a `RestartPolicy`.
+type restartTracker struct {
+	policy *RestartPolicy
+
+	lock     sync.Mutex
+	restarts []time.Time
+	total    int
+}
+
+func newRestartTracker(policy *RestartPolicy) *restartTracker {
+	return &restartTracker{policy: policy}
+}
+
+// configured returns whether a policy allowing restarts is set, there is no budget to enforce otherwise
+func (t *restartTracker) configured() bool {
+	return t.policy != nil && t.policy.MaxRestarts > 0
+}
+
+// next records a restart attempt at `now` and returns the delay to wait before
+// restarting, or an error explaining why the process must not be restarted.
+func (t *restartTracker) next(exitCode int, now time.Time) (time.Duration, error) {
+	if !t.configured() {
+		return 0, fmt.Errorf("no restart policy configured")
+	}
+
+	if !t.policy.isRetryable(exitCode) {
+		return 0, fmt.Errorf("exit code %d is not retryable", exitCode)
+	}
+
+	return t.charge(now)
+}
+
+// charge records a restart attempt at `now` against the budget, whatever the exit
+// code, and returns the delay to wait before restarting. The policy must be configured.
+func (t *restartTracker) charge(now time.Time) (time.Duration, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.policy.Window > 0 {
+		var inWindow []time.Time
+		for _, restart := range t.restarts {
+			if now.Sub(restart) < t.policy.Window {
+				inWindow = append(inWindow, restart)
+			}
+		}
+		t.restarts = inWindow
+	}
+
+	if len(t.restarts) >= t.policy.MaxRestarts {
+		return 0, fmt.Errorf("restart budget exhausted (%d restarts within %s)", len(t.restarts), t.policy.Window)
+	}
+
+	delay := t.policy.backoff(len(t.restarts))
+	t.restarts = append(t.restarts, now)
+	t.total++
+
+	return delay, nil
+}
+
+func (t *restartTracker) count() (inWindow int, total int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return len(t.restarts), t.total
+}
@@ -0,0 +1,188 @@
+package operator
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	nodeManager "github.com/streamingfast/node-manager"
+	logplugin "github.com/streamingfast/node-manager/log_plugin"
+	"github.com/streamingfast/shutter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRestartTracker(t *testing.T) {
+	tracker := newRestartTracker(&RestartPolicy{
+		MaxRestarts:    3,
+		Window:         time.Minute,
+		InitialBackoff: time.Second,
+		MaxBackoff:     3 * time.Second,
+		FatalExitCodes: []int{42},
+	})
+
+	now := time.Now()
+
+	_, err := tracker.next(42, now)
+	require.Error(t, err)
+
+	delay, err := tracker.next(1, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, delay)
+
+	delay, err = tracker.next(1, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, delay)
+
+	delay, err = tracker.next(1, now.Add(2*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, delay, "capped to max backoff")
+
+	_, err = tracker.next(1, now.Add(3*time.Second))
+	require.Error(t, err, "budget exhausted")
+
+	delay, err = tracker.next(1, now.Add(90*time.Second))
+	require.NoError(t, err, "restarts outside of window are not counted anymore")
+	assert.Equal(t, time.Second, delay)
+
+	inWindow, total := tracker.count()
+	assert.Equal(t, 1, inWindow)
+	assert.Equal(t, 4, total)
+}
+
+func TestRestartPolicy_IsRetryable(t *testing.T) {
+	policy := &RestartPolicy{RetryableExitCodes: []int{1, 2}, FatalExitCodes: []int{2}}
+
+	assert.True(t, policy.isRetryable(1))
+	assert.False(t, policy.isRetryable(2))
+	assert.False(t, policy.isRetryable(3))
+	assert.True(t, (&RestartPolicy{}).isRetryable(137))
+}
+
+func TestRestartTracker_NoPolicy(t *testing.T) {
+	_, err := newRestartTracker(nil).next(1, time.Now())
+	require.Error(t, err)
+}
+
+func TestOperator_CommandsRunDuringRestartBackoff(t *testing.T) {
+	superviser := newCrashingSuperviser()
+	o, err := New(zap.NewNop(), superviser, testReadiness(true), &Options{
+		RestartPolicy: &RestartPolicy{MaxRestarts: 3, InitialBackoff: time.Hour},
+	})
+	require.NoError(t, err)
+
+	go o.Launch("127.0.0.1:0")
+
+	require.Eventually(t, func() bool { return superviser.startCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+	superviser.crash()
+	require.Eventually(t, o.recovering.Load, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cmd, err := o.sendCommandAndWait(ctx, o.newCommand("maintenance", nil))
+	require.NoError(t, err, "command must not wait for the restart backoff")
+	assert.Equal(t, CommandStateSucceeded, cmd.Status().State)
+
+	o.Shutdown(nil)
+	select {
+	case <-o.Terminated():
+	case <-time.After(5 * time.Second):
+		t.Fatal("operator did not terminate")
+	}
+	assert.Equal(t, 1, superviser.startCount())
+}
+
+func TestOperator_RestartAfterBackoff(t *testing.T) {
+	superviser := newCrashingSuperviser()
+	o, err := New(zap.NewNop(), superviser, testReadiness(true), &Options{
+		RestartPolicy: &RestartPolicy{MaxRestarts: 3, InitialBackoff: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	launched := make(chan error, 1)
+	go func() { launched <- o.Launch("127.0.0.1:0") }()
+
+	require.Eventually(t, func() bool { return superviser.startCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+	superviser.crash()
+	require.Eventually(t, func() bool { return superviser.startCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	o.Shutdown(nil)
+	require.NoError(t, <-launched)
+}
+
+// crashingSuperviser is a process that only stops when asked to or on crash()
+type crashingSuperviser struct {
+	*shutter.Shutter
+
+	lock    sync.Mutex
+	running bool
+	stopped chan struct{}
+	starts  int
+}
+
+func newCrashingSuperviser() *crashingSuperviser {
+	s := &crashingSuperviser{Shutter: shutter.New()}
+	s.OnTerminating(func(_ error) {
+		if s.IsRunning() {
+			s.crash()
+		}
+	})
+
+	return s
+}
+
+func (s *crashingSuperviser) crash() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.running = false
+	close(s.stopped)
+}
+
+func (s *crashingSuperviser) startCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.starts
+}
+
+func (s *crashingSuperviser) Start(_ ...nodeManager.StartOption) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.running = true
+	s.stopped = make(chan struct{})
+	s.starts++
+	return nil
+}
+
+func (s *crashingSuperviser) Stop() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.running = false
+	s.stopped = nil
+	return nil
+}
+
+func (s *crashingSuperviser) IsRunning() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.running
+}
+
+func (s *crashingSuperviser) Stopped() <-chan struct{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped == nil {
+		return nil
+	}
+
+	return s.stopped
+}
+
+func (s *crashingSuperviser) GetCommand() string                      { return "test" }
+func (s *crashingSuperviser) GetName() string                         { return "test" }
+func (s *crashingSuperviser) ServerID() (string, error)               { return "", nil }
+func (s *crashingSuperviser) RegisterLogPlugin(_ logplugin.LogPlugin) {}
+func (s *crashingSuperviser) LastExitCode() int                       { return 1 }
+func (s *crashingSuperviser) LastLogLines() []string                  { return nil }
+func (s *crashingSuperviser) LastSeenBlockNum() uint64                { return 0 }
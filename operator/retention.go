@@ -0,0 +1,155 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/streamingfast/node-manager/metrics"
+	"go.uber.org/zap"
+)
+
+// RetentionPolicy defines which backups are kept when pruning, a backup is kept as
+// soon as one of the rules selects it. Days and weeks are computed in UTC.
+type RetentionPolicy struct {
+	// KeepLast keeps the N most recent backups
+	KeepLast int
+	// KeepDaily keeps the most recent backup of each of the last N days having backups
+	KeepDaily int
+	// KeepWeekly keeps the most recent backup of each of the last N ISO weeks having backups
+	KeepWeekly int
+}
+
+// NewRetentionPolicy parses the `keep-last`, `keep-daily` and `keep-weekly` values of a
+// backup config, it returns a nil policy when none of them are set.
+func NewRetentionPolicy(keepLast, keepDaily, keepWeekly string) (*RetentionPolicy, error) {
+	if keepLast == "" && keepDaily == "" && keepWeekly == "" {
+		return nil, nil
+	}
+
+	policy := &RetentionPolicy{}
+	for _, field := range []struct {
+		name  string
+		in    string
+		value *int
+	}{
+		{"keep-last", keepLast, &policy.KeepLast},
+		{"keep-daily", keepDaily, &policy.KeepDaily},
+		{"keep-weekly", keepWeekly, &policy.KeepWeekly},
+	} {
+		if field.in == "" {
+			continue
+		}
+
+		value, err := strconv.ParseUint(field.in, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s in retention policy (err: %w)", field.name, err)
+		}
+		*field.value = int(value)
+	}
+
+	if policy.KeepLast == 0 && policy.KeepDaily == 0 && policy.KeepWeekly == 0 {
+		return nil, fmt.Errorf("retention policy would prune every backup, at least one of keep-last, keep-daily or keep-weekly must be greater than 0")
+	}
+
+	return policy, nil
+}
+
+// Prunable returns the backups that are not selected by any rule of the policy.
+func (p *RetentionPolicy) Prunable(backups []*BackupInfo) []*BackupInfo {
+	sorted := make([]*BackupInfo, len(backups))
+	copy(sorted, backups)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.After(sorted[j].Timestamp)
+	})
+
+	kept := make(map[*BackupInfo]bool)
+	for i := 0; i < p.KeepLast && i < len(sorted); i++ {
+		kept[sorted[i]] = true
+	}
+
+	keepPerBucket := func(count int, bucketOf func(b *BackupInfo) string) {
+		seen := make(map[string]bool)
+		for _, backup := range sorted {
+			if len(seen) >= count {
+				return
+			}
+
+			bucket := bucketOf(backup)
+			if seen[bucket] {
+				continue
+			}
+
+			seen[bucket] = true
+			kept[backup] = true
+		}
+	}
+
+	keepPerBucket(p.KeepDaily, func(b *BackupInfo) string {
+		return b.Timestamp.UTC().Format("2006-01-02")
+	})
+
+	keepPerBucket(p.KeepWeekly, func(b *BackupInfo) string {
+		year, week := b.Timestamp.UTC().ISOWeek()
+		return fmt.Sprintf("%d-%02d", year, week)
+	})
+
+	var out []*BackupInfo
+	for _, backup := range sorted {
+		if !kept[backup] {
+			out = append(out, backup)
+		}
+	}
+
+	return out
+}
+
+func (o *Operator) pruneBackups(moduleName string, mod BackupModule) {
+	policy := o.retentionPolicies[moduleName]
+	if policy == nil {
+		return
+	}
+
+	prunable, ok := mod.(PrunableBackupModule)
+	if !ok {
+		o.zlogger.Warn("retention policy configured but backup module does not support pruning", zap.String("backuper_name", moduleName))
+		return
+	}
+
+	backups, err := prunable.ListBackups()
+	if err != nil {
+		o.zlogger.Error("unable to list backups for pruning", zap.String("backuper_name", moduleName), zap.Error(err))
+		return
+	}
+
+	var pruned []string
+	for _, backup := range policy.Prunable(backups) {
+		if err := prunable.DeleteBackup(backup.Name); err != nil {
+			o.zlogger.Error("unable to prune backup", zap.String("backuper_name", moduleName), zap.String("backup_name", backup.Name), zap.Error(err))
+			continue
+		}
+
+		pruned = append(pruned, backup.Name)
+		metrics.BackupsPruned.Inc(moduleName)
+	}
+
+	o.zlogger.Info("pruned backups according to retention policy",
+		zap.String("backuper_name", moduleName),
+		zap.Int("backup_count", len(backups)),
+		zap.Strings("pruned", pruned),
+	)
+}
@@ -0,0 +1,66 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRetentionPolicy(t *testing.T) {
+	policy, err := NewRetentionPolicy("", "", "")
+	require.NoError(t, err)
+	assert.Nil(t, policy)
+
+	policy, err = NewRetentionPolicy("3", "", "4")
+	require.NoError(t, err)
+	assert.Equal(t, &RetentionPolicy{KeepLast: 3, KeepWeekly: 4}, policy)
+
+	_, err = NewRetentionPolicy("0", "0", "")
+	require.Error(t, err)
+
+	_, err = NewRetentionPolicy("-1", "", "")
+	require.Error(t, err)
+}
+
+func TestRetentionPolicy_Prunable(t *testing.T) {
+	base := time.Date(2022, 11, 14, 12, 0, 0, 0, time.UTC) // a Monday
+	backup := func(name string, offset time.Duration) *BackupInfo {
+		return &BackupInfo{Name: name, Timestamp: base.Add(offset)}
+	}
+
+	backups := []*BackupInfo{
+		backup("mon-1", 0),
+		backup("mon-2", 2*time.Hour),
+		backup("tue-1", 24*time.Hour),
+		backup("tue-2", 26*time.Hour),
+		backup("prev-week-sun", -24*time.Hour),
+		backup("prev-week-fri", -3*24*time.Hour),
+		backup("two-weeks-ago", -8*24*time.Hour),
+	}
+
+	names := func(in []*BackupInfo) (out []string) {
+		for _, b := range in {
+			out = append(out, b.Name)
+		}
+		return
+	}
+
+	cases := []struct {
+		name     string
+		policy   *RetentionPolicy
+		expected []string
+	}{
+		{"keep last", &RetentionPolicy{KeepLast: 2}, []string{"mon-2", "mon-1", "prev-week-sun", "prev-week-fri", "two-weeks-ago"}},
+		{"keep daily", &RetentionPolicy{KeepDaily: 2}, []string{"tue-1", "mon-1", "prev-week-sun", "prev-week-fri", "two-weeks-ago"}},
+		{"keep weekly", &RetentionPolicy{KeepWeekly: 3}, []string{"tue-1", "mon-2", "mon-1", "prev-week-fri"}},
+		{"combined", &RetentionPolicy{KeepLast: 1, KeepDaily: 1, KeepWeekly: 2}, []string{"tue-1", "mon-2", "mon-1", "prev-week-fri", "two-weeks-ago"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, names(tc.policy.Prunable(backups)))
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	nodeManager "github.com/streamingfast/node-manager"
+)
+
+// HeadBlockSource provides the latest head block seen, like `MetricsAndReadinessManager`
+type HeadBlockSource interface {
+	LastHeadBlock() (ref bstream.BlockRef, blockTime time.Time)
+}
+
+// UploaderBacklogSource provides the amount of files waiting to be uploaded, like `MindReaderPlugin`
+type UploaderBacklogSource interface {
+	UploaderBacklog() int
+}
+
+// Status is the JSON document returned by the `/v1/status` endpoint
+type Status struct {
+	Process         *ProcessStatus    `json:"process"`
+	Ready           bool              `json:"ready"`
+	NotReadyReason  string            `json:"not_ready_reason,omitempty"`
+	NotReadyReasons []*NotReadyReason `json:"not_ready_reasons,omitempty"`
+	HeadBlock       *HeadBlockStatus  `json:"head_block,omitempty"`
+	PendingCommands int               `json:"pending_commands"`
+	LastBackup      *CommandStatus    `json:"last_backup,omitempty"`
+	UploaderBacklog *int              `json:"uploader_backlog,omitempty"`
+}
+
+type ProcessStatus struct {
+	Name         string     `json:"name"`
+	Running      bool       `json:"running"`
+	State        string     `json:"state,omitempty"`
+	PID          int        `json:"pid,omitempty"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	Uptime       string     `json:"uptime,omitempty"`
+	LastExitCode int        `json:"last_exit_code"`
+	// LastStoppedBy is the stop sequence step that ended the last execution, empty when it exited by itself
+	LastStoppedBy string `json:"last_stopped_by,omitempty"`
+	// RestartCount is the amount of restarts performed by the restart policy since the operator started
+	RestartCount int `json:"restart_count"`
+	// Resources is the latest resource usage sample, kept once the process stopped
+	Resources *ResourceUsageStatus `json:"resources,omitempty"`
+}
+
+type ResourceUsageStatus struct {
+	PID           int       `json:"pid"`
+	SampledAt     time.Time `json:"sampled_at"`
+	CPUSeconds    float64   `json:"cpu_seconds"`
+	CPUPercent    float64   `json:"cpu_percent"`
+	ResidentBytes uint64    `json:"resident_bytes"`
+	OpenFDs       int       `json:"open_fds"`
+	Threads       int       `json:"threads"`
+	IOReadBytes   uint64    `json:"io_read_bytes"`
+	IOWriteBytes  uint64    `json:"io_write_bytes"`
+}
+
+type HeadBlockStatus struct {
+	Num   uint64     `json:"num"`
+	ID    string     `json:"id,omitempty"`
+	Time  *time.Time `json:"time,omitempty"`
+	Drift string     `json:"drift,omitempty"`
+}
+
+func (o *Operator) statusHandler(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, o.Status())
+}
+
+// SetStatusSources sets `Options.HeadBlockSource` and `Options.UploaderBacklogSource`
+// when they are not already set, it must be called before `Launch`. Nil sources are ignored.
+func (o *Operator) SetStatusSources(headBlock HeadBlockSource, uploaderBacklog UploaderBacklogSource) {
+	if o.options.HeadBlockSource == nil {
+		o.options.HeadBlockSource = headBlock
+	}
+
+	if o.options.UploaderBacklogSource == nil {
+		o.options.UploaderBacklogSource = uploaderBacklog
+	}
+}
+
+// Status aggregates the state of the process, of the operator and of the status sources
+func (o *Operator) Status() *Status {
+	reasons := o.notReadyReasons()
+
+	status := &Status{
+		Process:         o.processStatus(),
+		Ready:           len(reasons) == 0,
+		NotReadyReason:  formatNotReadyReasons(reasons),
+		NotReadyReasons: reasons,
+		HeadBlock:       o.headBlockStatus(),
+		PendingCommands: len(o.commandQueue.list()),
+		LastBackup:      o.lastBackupStatus(),
+	}
+
+	if o.options.UploaderBacklogSource != nil {
+		backlog := o.options.UploaderBacklogSource.UploaderBacklog()
+		status.UploaderBacklog = &backlog
+	}
+
+	return status
+}
+
+func (o *Operator) processStatus() *ProcessStatus {
+	_, restarts := o.restartTracker.count()
+
+	status := &ProcessStatus{
+		Name:         o.Superviser.GetName(),
+		Running:      o.Superviser.IsRunning(),
+		LastExitCode: o.Superviser.LastExitCode(),
+		RestartCount: restarts,
+	}
+
+	if reporter, ok := o.Superviser.(nodeManager.ExitStatusChainSuperviser); ok {
+		if exitStatus := reporter.LastExitStatus(); exitStatus != nil {
+			status.LastExitCode = exitStatus.ExitCode
+			status.LastStoppedBy = string(exitStatus.StoppedBy)
+		}
+	}
+
+	if reporter, ok := o.Superviser.(nodeManager.ProcessInfoChainSuperviser); ok {
+		if info := reporter.ProcessInfo(); info != nil {
+			status.State = info.State
+			if status.Running {
+				status.PID = info.PID
+				if !info.StartedAt.IsZero() {
+					startedAt := info.StartedAt
+					status.StartedAt = &startedAt
+					status.Uptime = time.Since(startedAt).Truncate(time.Second).String()
+				}
+			}
+		}
+	}
+
+	if reporter, ok := o.Superviser.(nodeManager.ResourceUsageChainSuperviser); ok {
+		if sample := reporter.LastResourceSample(); sample != nil {
+			status.Resources = &ResourceUsageStatus{
+				PID:           sample.PID,
+				SampledAt:     sample.SampledAt,
+				CPUSeconds:    sample.CPUSeconds,
+				CPUPercent:    sample.CPUPercent,
+				ResidentBytes: sample.ResidentBytes,
+				OpenFDs:       sample.OpenFDs,
+				Threads:       sample.Threads,
+				IOReadBytes:   sample.IOReadBytes,
+				IOWriteBytes:  sample.IOWriteBytes,
+			}
+		}
+	}
+
+	return status
+}
+
+func (o *Operator) headBlockStatus() *HeadBlockStatus {
+	if o.options.HeadBlockSource != nil {
+		if ref, blockTime := o.options.HeadBlockSource.LastHeadBlock(); ref != nil {
+			status := &HeadBlockStatus{Num: ref.Num(), ID: ref.ID()}
+			if !blockTime.IsZero() {
+				status.Time = &blockTime
+				status.Drift = time.Since(blockTime).Truncate(time.Second).String()
+			}
+
+			return status
+		}
+	}
+
+	if num := o.Superviser.LastSeenBlockNum(); num != 0 {
+		return &HeadBlockStatus{Num: num}
+	}
+
+	return nil
+}
+
+// lastBackupStatus returns the most recent backup command that completed, nil
+// when none did since the operator started
+func (o *Operator) lastBackupStatus() *CommandStatus {
+	for _, c := range o.commandHistory.list() {
+		if c.cmd == "backup" && c.completed() {
+			return c.Status()
+		}
+	}
+
+	return nil
+}
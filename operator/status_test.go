@@ -0,0 +1,82 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	nodeManager "github.com/streamingfast/node-manager"
+	"github.com/streamingfast/shutter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+type testSuperviser struct {
+	nodeManager.ChainSuperviser
+
+	running          bool
+	lastExitCode     int
+	lastSeenBlockNum uint64
+}
+
+func (s *testSuperviser) GetName() string          { return "test" }
+func (s *testSuperviser) IsRunning() bool          { return s.running }
+func (s *testSuperviser) LastExitCode() int        { return s.lastExitCode }
+func (s *testSuperviser) LastSeenBlockNum() uint64 { return s.lastSeenBlockNum }
+
+type testStatusSource struct {
+	headBlock     bstream.BlockRef
+	headBlockTime time.Time
+	backlog       int
+}
+
+func (s *testStatusSource) LastHeadBlock() (bstream.BlockRef, time.Time) {
+	return s.headBlock, s.headBlockTime
+}
+
+func (s *testStatusSource) UploaderBacklog() int {
+	return s.backlog
+}
+
+func TestOperator_Status(t *testing.T) {
+	o := &Operator{
+		Shutter:        shutter.New(),
+		aboutToStop:    atomic.NewBool(false),
+		options:        &Options{},
+		Superviser:     &testSuperviser{lastExitCode: 2, lastSeenBlockNum: 10},
+		commandQueue:   newCommandQueue(0),
+		commandHistory: newCommandHistory(0),
+		restartTracker: newRestartTracker(nil),
+		zlogger:        zap.NewNop(),
+	}
+
+	backup := o.newCommand("backup", nil)
+	backup.Return(nil)
+	_, err := o.enqueue(o.newCommand("backup", nil))
+	require.NoError(t, err)
+
+	status := o.Status()
+	assert.Equal(t, &ProcessStatus{Name: "test", LastExitCode: 2}, status.Process)
+	assert.False(t, status.Ready)
+	assert.Equal(t, "chain is not running", status.NotReadyReason)
+	assert.Equal(t, []*NotReadyReason{{NotReadyNotRunning, "chain is not running"}}, status.NotReadyReasons)
+	assert.Equal(t, &HeadBlockStatus{Num: 10}, status.HeadBlock)
+	assert.Equal(t, 1, status.PendingCommands)
+	require.NotNil(t, status.LastBackup)
+	assert.Equal(t, backup.id, status.LastBackup.ID, "pending backup is not the last one")
+	assert.Nil(t, status.UploaderBacklog)
+
+	blockTime := time.Now().Add(-time.Minute)
+	source := &testStatusSource{headBlock: bstream.NewBlockRef("00000014a", 20), headBlockTime: blockTime, backlog: 3}
+	o.options.HeadBlockSource, o.options.UploaderBacklogSource = source, source
+
+	status = o.Status()
+	require.NotNil(t, status.HeadBlock)
+	assert.Equal(t, uint64(20), status.HeadBlock.Num)
+	assert.Equal(t, "00000014a", status.HeadBlock.ID)
+	assert.Equal(t, &blockTime, status.HeadBlock.Time)
+	require.NotNil(t, status.UploaderBacklog)
+	assert.Equal(t, 3, *status.UploaderBacklog)
+}
@@ -0,0 +1,618 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/streamingfast/dstore"
+)
+
+// tarballBackupNameRegex also matches the names without time of older backups
+var tarballBackupNameRegex = regexp.MustCompile(`^(\d{10})(-\d{8}T\d{6}\.\d{3}Z)?$`)
+
+const tarballBackupTimeLayout = "20060102T150405.000Z"
+
+// Work directories of a restore, created inside the data directory so restored
+// files are renamed within the same filesystem, even when the data directory is a
+// mount point. They are never archived.
+const (
+	restoringDirName = ".node-manager-restoring"
+	previousDirName  = ".node-manager-previous"
+)
+
+// TarballBackupModule archives a data directory as a tarball (optionally zstd
+// compressed) pushed to a `dstore.Store`, alongside its `BackupManifest`. Backups
+// are named after the last seen block number and the backup time, a backup is only
+// considered complete once its manifest has been written.
+type TarballBackupModule struct {
+	store    dstore.Store
+	path     string
+	compress bool
+}
+
+// TarballBackupModuleFactory creates a `TarballBackupModule` from a kv config like
+// `type=tarball store=gs://bucket/backups path=/data/node compression=zstd`, the
+// `compression` key accepts `zstd` (default) or `none`.
+func TarballBackupModuleFactory(conf BackupModuleConfig) (BackupModule, error) {
+	if conf["store"] == "" {
+		return nil, fmt.Errorf("tarball backup module requires a 'store' value")
+	}
+
+	if conf["path"] == "" {
+		return nil, fmt.Errorf("tarball backup module requires a 'path' value")
+	}
+
+	compress := true
+	switch conf["compression"] {
+	case "", "zstd":
+	case "none":
+		compress = false
+	default:
+		return nil, fmt.Errorf("invalid compression %q for tarball backup module, accepted values are 'zstd' and 'none'", conf["compression"])
+	}
+
+	return NewTarballBackupModule(conf["store"], conf["path"], compress)
+}
+
+func NewTarballBackupModule(storeURL string, path string, compress bool) (*TarballBackupModule, error) {
+	store, err := dstore.NewStore(storeURL, "", "", true)
+	if err != nil {
+		return nil, fmt.Errorf("new tarball backup store: %w", err)
+	}
+
+	return &TarballBackupModule{
+		store:    store,
+		path:     filepath.Clean(path),
+		compress: compress,
+	}, nil
+}
+
+func (m *TarballBackupModule) RequiresStop() bool {
+	return true
+}
+
+func (m *TarballBackupModule) objectName(backupName string) string {
+	if m.compress {
+		return backupName + ".tar.zst"
+	}
+	return backupName + ".tar"
+}
+
+func (m *TarballBackupModule) Backup(lastSeenBlockNum uint32) (string, error) {
+	return m.BackupWithContext(context.Background(), lastSeenBlockNum)
+}
+
+func (m *TarballBackupModule) BackupWithContext(ctx context.Context, lastSeenBlockNum uint32) (string, error) {
+	now := time.Now()
+	backupName := fmt.Sprintf("%010d-%s", lastSeenBlockNum, now.UTC().Format(tarballBackupTimeLayout))
+	manifest := &BackupManifest{BackupName: backupName, BlockNum: uint64(lastSeenBlockNum), CreatedAt: now}
+
+	exists, err := m.store.FileExists(ctx, ManifestObjectName(backupName))
+	if err != nil {
+		return "", fmt.Errorf("checking existing backup %q: %w", backupName, err)
+	}
+	if exists {
+		return "", fmt.Errorf("backup %q already exists", backupName)
+	}
+
+	pipeRead, pipeWrite := io.Pipe()
+
+	// Same as in the mindreader archiver, the store must read the pipe concurrently with the archive being written
+	writeObjectErrChan := make(chan error)
+	go func() {
+		writeObjectErrChan <- m.store.WriteObject(ctx, m.objectName(backupName), pipeRead)
+	}()
+
+	archiveErr := m.writeArchive(ctx, pipeWrite, manifest)
+	pipeWrite.CloseWithError(archiveErr)
+
+	writeErr := <-writeObjectErrChan
+	if archiveErr != nil {
+		return "", fmt.Errorf("archiving %q: %w", m.path, archiveErr)
+	}
+
+	if writeErr != nil {
+		return "", fmt.Errorf("writing backup %q: %w", backupName, writeErr)
+	}
+
+	if err := WriteManifest(ctx, m.store, manifest); err != nil {
+		return "", err
+	}
+
+	return backupName, nil
+}
+
+func (m *TarballBackupModule) writeArchive(ctx context.Context, out io.Writer, manifest *BackupManifest) error {
+	var closers []io.Closer
+	if m.compress {
+		encoder, err := zstd.NewWriter(out)
+		if err != nil {
+			return fmt.Errorf("new zstd writer: %w", err)
+		}
+
+		out = encoder
+		closers = append(closers, encoder)
+	}
+
+	tarWriter := tar.NewWriter(out)
+	closers = append([]io.Closer{tarWriter}, closers...)
+
+	err := filepath.Walk(m.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(m.path, path)
+		if err != nil {
+			return err
+		}
+
+		if relPath == "." {
+			return nil
+		}
+
+		if relPath == restoringDirName || relPath == previousDirName {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var link string
+		switch {
+		case info.IsDir(), info.Mode().IsRegular():
+		case info.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported file %q of type %s", relPath, info.Mode().Type())
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if link != "" {
+			manifest.AddSymlink(header.Name, link)
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return manifest.AddFile(header.Name, io.TeeReader(file, tarWriter))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *TarballBackupModule) Restore(name string) error {
+	return m.RestoreWithContext(context.Background(), name)
+}
+
+// RestoreWithContext extracts the backup in a work directory inside the data
+// directory, checking it against the backup manifest, and only swaps it with the
+// content of the data directory once the extraction fully succeeded. An aborted
+// restore leaves the data directory untouched.
+func (m *TarballBackupModule) RestoreWithContext(ctx context.Context, name string) error {
+	backupName, err := m.resolveBackupName(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := ReadManifest(ctx, m.store, backupName)
+	if err != nil {
+		return err
+	}
+
+	previousPath := filepath.Join(m.path, previousDirName)
+	if _, err := os.Lstat(previousPath); err == nil {
+		return fmt.Errorf("data directory content of an interrupted restore was left in %q, move it back or remove it before restoring", previousPath)
+	}
+
+	restoringPath := filepath.Join(m.path, restoringDirName)
+	if err := os.RemoveAll(restoringPath); err != nil {
+		return fmt.Errorf("cleaning up previous restore directory: %w", err)
+	}
+
+	extracted, err := m.readArchive(ctx, backupName, restoringPath)
+	if err != nil {
+		os.RemoveAll(restoringPath)
+		return fmt.Errorf("extracting backup %q: %w", backupName, err)
+	}
+
+	if err := manifest.Compare(extracted); err != nil {
+		os.RemoveAll(restoringPath)
+		return fmt.Errorf("extracted backup %q: %w", backupName, err)
+	}
+
+	if err := swapDirectoryContent(m.path, restoringPath, previousPath); err != nil {
+		// When the former content could not be put back, everything is left in place for a manual recovery
+		if _, statErr := os.Lstat(previousPath); os.IsNotExist(statErr) {
+			os.RemoveAll(restoringPath)
+		}
+		return fmt.Errorf("moving restored backup %q to data directory %q: %w", backupName, m.path, err)
+	}
+
+	return nil
+}
+
+// swapDirectoryContent moves the entries of `dir` to `aside`, then the entries of
+// `replacement` to `dir`, only renaming within `dir`. When a move fails, the moved
+// entries are put back. The former entries are deleted once the swap succeeded.
+func swapDirectoryContent(dir string, replacement string, aside string) error {
+	current, err := directoryEntries(dir)
+	if err != nil {
+		return err
+	}
+
+	replacing, err := directoryEntries(replacement)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(aside, 0700); err != nil {
+		return err
+	}
+
+	if movedAside, err := moveEntries(current, dir, aside); err != nil {
+		if _, rollbackErr := moveEntries(movedAside, aside, dir); rollbackErr != nil {
+			return fmt.Errorf("%w, moving back former entries failed: %s", err, rollbackErr)
+		}
+		os.Remove(aside)
+		return err
+	}
+
+	if movedIn, err := moveEntries(replacing, replacement, dir); err != nil {
+		_, rollbackErr := moveEntries(movedIn, dir, replacement)
+		if rollbackErr == nil {
+			_, rollbackErr = moveEntries(current, aside, dir)
+		}
+		if rollbackErr != nil {
+			return fmt.Errorf("%w, moving back former entries failed: %s", err, rollbackErr)
+		}
+		os.Remove(aside)
+		return err
+	}
+
+	if err := os.Remove(replacement); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(aside); err != nil {
+		return fmt.Errorf("removing former entries: %w", err)
+	}
+
+	return nil
+}
+
+// directoryEntries lists the names of the entries of `dir`, except the restore work directories
+func directoryEntries(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Name() == restoringDirName || entry.Name() == previousDirName {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+
+	return names, nil
+}
+
+// moveEntries renames the `names` entries from `from` to `to`, returning the ones moved before an error
+func moveEntries(names []string, from string, to string) (moved []string, err error) {
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(from, name), filepath.Join(to, name)); err != nil {
+			return moved, err
+		}
+		moved = append(moved, name)
+	}
+
+	return moved, nil
+}
+
+func (m *TarballBackupModule) Verify(ctx context.Context, name string) error {
+	backupName, err := m.resolveBackupName(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := ReadManifest(ctx, m.store, backupName)
+	if err != nil {
+		return err
+	}
+
+	actual, err := m.readArchive(ctx, backupName, "")
+	if err != nil {
+		return fmt.Errorf("reading backup %q: %w", backupName, err)
+	}
+
+	return manifest.Compare(actual)
+}
+
+// readArchive streams the backup from the store, building the manifest of its
+// content. Files are extracted to `destination` unless it is empty.
+func (m *TarballBackupModule) readArchive(ctx context.Context, backupName string, destination string) (*BackupManifest, error) {
+	reader, err := m.store.OpenObject(ctx, m.objectName(backupName))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var in io.Reader = reader
+	if m.compress {
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("new zstd reader: %w", err)
+		}
+		defer decoder.Close()
+
+		in = decoder
+	}
+
+	if destination != "" {
+		if err := os.MkdirAll(destination, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest := &BackupManifest{BackupName: backupName}
+	symlinks := map[string]bool{}
+	tarReader := tar.NewReader(in)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		cleanName := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(cleanName) || cleanName == ".." || strings.HasPrefix(cleanName, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("invalid path %q in archive", header.Name)
+		}
+
+		// Extracting beneath a symlink would write wherever it points to
+		for parent := filepath.Dir(cleanName); parent != "."; parent = filepath.Dir(parent) {
+			if symlinks[parent] {
+				return nil, fmt.Errorf("invalid path %q in archive, it is beneath symlink %q", header.Name, filepath.ToSlash(parent))
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if destination != "" {
+				if err := os.MkdirAll(filepath.Join(destination, cleanName), os.FileMode(header.Mode)|0700); err != nil {
+					return nil, err
+				}
+			}
+
+		case tar.TypeReg:
+			if destination == "" {
+				if err := manifest.AddFile(header.Name, tarReader); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			if err := extractFile(filepath.Join(destination, cleanName), os.FileMode(header.Mode), header.Name, tarReader, manifest); err != nil {
+				return nil, err
+			}
+
+		case tar.TypeSymlink:
+			symlinks[cleanName] = true
+			manifest.AddSymlink(header.Name, header.Linkname)
+			if destination != "" {
+				if err := extractSymlink(filepath.Join(destination, cleanName), header.Linkname); err != nil {
+					return nil, err
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("unsupported entry type %q for %q in archive", header.Typeflag, header.Name)
+		}
+	}
+
+	manifest.sort()
+	return manifest, nil
+}
+
+func extractFile(path string, mode os.FileMode, name string, content io.Reader, manifest *BackupManifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	if err := manifest.AddFile(name, io.TeeReader(content, file)); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func extractSymlink(path string, target string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.Symlink(target, path)
+}
+
+func (m *TarballBackupModule) resolveBackupName(ctx context.Context, name string) (string, error) {
+	if name != "latest" {
+		return name, nil
+	}
+
+	backups, err := m.listBackups(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	latest := selectBackup(backups, nil, "")
+	if latest == nil {
+		return "", fmt.Errorf("no backup found in store %q", m.store.BaseURL().Redacted())
+	}
+
+	return latest.Name, nil
+}
+
+func (m *TarballBackupModule) ListBackups() ([]*BackupInfo, error) {
+	return m.listBackups(context.Background())
+}
+
+func (m *TarballBackupModule) listBackups(ctx context.Context) ([]*BackupInfo, error) {
+	backups, err := m.listBackupNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, backup := range backups {
+		if err := m.describeBackup(ctx, backup); err != nil {
+			return nil, err
+		}
+	}
+
+	return backups, nil
+}
+
+// ListBackupNames only walks the store, the timestamp comes from the backup name and
+// is missing for older backups
+func (m *TarballBackupModule) ListBackupNames() ([]*BackupInfo, error) {
+	return m.listBackupNames(context.Background())
+}
+
+func (m *TarballBackupModule) listBackupNames(ctx context.Context) ([]*BackupInfo, error) {
+	var backups []*BackupInfo
+	err := m.store.Walk(ctx, "", func(filename string) error {
+		if !strings.HasSuffix(filename, manifestSuffix) {
+			return nil
+		}
+
+		backupName := strings.TrimSuffix(filename, manifestSuffix)
+		match := tarballBackupNameRegex.FindStringSubmatch(backupName)
+		if match == nil {
+			return nil
+		}
+
+		blockNum, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		backup := &BackupInfo{Name: backupName, BlockNum: blockNum}
+		if match[2] != "" {
+			if backup.Timestamp, err = time.Parse(tarballBackupTimeLayout, strings.TrimPrefix(match[2], "-")); err != nil {
+				return err
+			}
+		}
+
+		backups = append(backups, backup)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking backup store: %w", err)
+	}
+
+	return backups, nil
+}
+
+// DescribeBackup reads the size and creation time of the backup from its manifest
+func (m *TarballBackupModule) DescribeBackup(backup *BackupInfo) error {
+	return m.describeBackup(context.Background(), backup)
+}
+
+func (m *TarballBackupModule) describeBackup(ctx context.Context, backup *BackupInfo) error {
+	manifest, err := ReadManifest(ctx, m.store, backup.Name)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, file := range manifest.Files {
+		size += file.Size
+	}
+
+	backup.Size = size
+	backup.Timestamp = manifest.CreatedAt
+	return nil
+}
+
+// DeleteBackup removes the manifest first so a partially deleted backup is never listed
+func (m *TarballBackupModule) DeleteBackup(name string) error {
+	ctx := context.Background()
+
+	if err := m.store.DeleteObject(ctx, ManifestObjectName(name)); err != nil {
+		return fmt.Errorf("deleting manifest of %q: %w", name, err)
+	}
+
+	if err := m.store.DeleteObject(ctx, m.objectName(name)); err != nil {
+		return fmt.Errorf("deleting backup %q: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package operator
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarballBackupModule(t *testing.T) {
+	for _, compression := range []string{"zstd", "none"} {
+		t.Run(compression, func(t *testing.T) {
+			dataDir := filepath.Join(t.TempDir(), "data")
+			writeTestFile(t, filepath.Join(dataDir, "blocks", "blocks.log"), "blocks v1")
+			writeTestFile(t, filepath.Join(dataDir, "state", "shared_memory.bin"), "state v1")
+
+			mod, err := TarballBackupModuleFactory(BackupModuleConfig{
+				"type":        "tarball",
+				"store":       "file://" + t.TempDir(),
+				"path":        dataDir,
+				"compression": compression,
+			})
+			require.NoError(t, err)
+			tarball := mod.(*TarballBackupModule)
+
+			firstName, err := tarball.Backup(1000)
+			require.NoError(t, err)
+			assert.Regexp(t, `^0000001000-\d{8}T\d{6}\.\d{3}Z$`, firstName)
+
+			writeTestFile(t, filepath.Join(dataDir, "state", "shared_memory.bin"), "state v2")
+			writeTestFile(t, filepath.Join(dataDir, "extra"), "extra")
+
+			secondName, err := tarball.Backup(2000)
+			require.NoError(t, err)
+
+			backups, err := tarball.ListBackups()
+			require.NoError(t, err)
+			require.Len(t, backups, 2)
+			assert.Equal(t, uint64(2000), selectBackup(backups, nil, "").BlockNum)
+
+			require.NoError(t, tarball.Verify(context.Background(), "latest"))
+			require.NoError(t, tarball.Verify(context.Background(), firstName))
+
+			require.NoError(t, tarball.Restore(firstName))
+			assertFileContent(t, filepath.Join(dataDir, "blocks", "blocks.log"), "blocks v1")
+			assertFileContent(t, filepath.Join(dataDir, "state", "shared_memory.bin"), "state v1")
+			_, err = os.Stat(filepath.Join(dataDir, "extra"))
+			assert.True(t, os.IsNotExist(err))
+			assertNoRestoreWorkDirectories(t, dataDir)
+
+			require.NoError(t, tarball.Restore("latest"))
+			assertFileContent(t, filepath.Join(dataDir, "state", "shared_memory.bin"), "state v2")
+			assertFileContent(t, filepath.Join(dataDir, "extra"), "extra")
+
+			require.NoError(t, tarball.DeleteBackup(secondName))
+			backups, err = tarball.ListBackups()
+			require.NoError(t, err)
+			require.Len(t, backups, 1)
+			assert.Equal(t, firstName, backups[0].Name)
+		})
+	}
+}
+
+func TestTarballBackupModule_CorruptedBackup(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	storeDir := t.TempDir()
+	writeTestFile(t, filepath.Join(dataDir, "state"), "state v1")
+
+	tarball, err := NewTarballBackupModule("file://"+storeDir, dataDir, false)
+	require.NoError(t, err)
+
+	name, err := tarball.Backup(1000)
+	require.NoError(t, err)
+
+	// Truncate the archive within the file content, past its 512 bytes header, to simulate a corrupted upload
+	archivePath := filepath.Join(storeDir, name+".tar")
+	content, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(archivePath, content[:512+4], 0644))
+
+	require.Error(t, tarball.Verify(context.Background(), name))
+
+	writeTestFile(t, filepath.Join(dataDir, "state"), "state v2")
+	require.Error(t, tarball.Restore(name))
+	assertFileContent(t, filepath.Join(dataDir, "state"), "state v2")
+	assertNoRestoreWorkDirectories(t, dataDir)
+}
+
+func TestTarballBackupModule_Canceled(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	writeTestFile(t, filepath.Join(dataDir, "state"), "state v1")
+
+	tarball, err := NewTarballBackupModule("file://"+t.TempDir(), dataDir, true)
+	require.NoError(t, err)
+
+	name, err := tarball.Backup(1000)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = tarball.BackupWithContext(ctx, 2000)
+	require.ErrorIs(t, err, context.Canceled)
+
+	writeTestFile(t, filepath.Join(dataDir, "state"), "state v2")
+	require.ErrorIs(t, tarball.RestoreWithContext(ctx, name), context.Canceled)
+	assertFileContent(t, filepath.Join(dataDir, "state"), "state v2")
+	assertNoRestoreWorkDirectories(t, dataDir)
+}
+
+func TestTarballBackupModule_SameBlock(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	writeTestFile(t, filepath.Join(dataDir, "state"), "state v1")
+
+	tarball, err := NewTarballBackupModule("file://"+t.TempDir(), dataDir, true)
+	require.NoError(t, err)
+
+	firstName, err := tarball.Backup(0)
+	require.NoError(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+	writeTestFile(t, filepath.Join(dataDir, "state"), "state v2")
+	secondName, err := tarball.Backup(0)
+	require.NoError(t, err)
+	assert.NotEqual(t, firstName, secondName)
+
+	backups, err := tarball.ListBackups()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Equal(t, secondName, selectBackup(backups, nil, "").Name)
+
+	names, err := tarball.ListBackupNames()
+	require.NoError(t, err)
+	require.Len(t, names, 2)
+	assert.Equal(t, secondName, selectBackup(names, nil, "").Name, "timestamps come from the names")
+
+	require.NoError(t, tarball.Restore(firstName))
+	assertFileContent(t, filepath.Join(dataDir, "state"), "state v1")
+}
+
+func TestTarballBackupModule_Symlinks(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	writeTestFile(t, filepath.Join(dataDir, "blocks", "blocks.log"), "blocks")
+	require.NoError(t, os.Symlink("blocks/blocks.log", filepath.Join(dataDir, "current")))
+
+	tarball, err := NewTarballBackupModule("file://"+t.TempDir(), dataDir, true)
+	require.NoError(t, err)
+
+	name, err := tarball.Backup(1000)
+	require.NoError(t, err)
+	require.NoError(t, tarball.Verify(context.Background(), name))
+
+	require.NoError(t, os.Remove(filepath.Join(dataDir, "current")))
+	require.NoError(t, tarball.Restore(name))
+
+	target, err := os.Readlink(filepath.Join(dataDir, "current"))
+	require.NoError(t, err)
+	assert.Equal(t, "blocks/blocks.log", target)
+	assertFileContent(t, filepath.Join(dataDir, "current"), "blocks")
+}
+
+func TestTarballBackupModule_UnsupportedFile(t *testing.T) {
+	dataDir, err := os.MkdirTemp("", "data")
+	require.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+
+	// Kept short, unix socket paths are limited to about a hundred characters
+	listener, err := net.Listen("unix", filepath.Join(dataDir, "sock"))
+	require.NoError(t, err)
+	defer listener.Close()
+
+	tarball, err := NewTarballBackupModule("file://"+t.TempDir(), dataDir, false)
+	require.NoError(t, err)
+
+	_, err = tarball.Backup(1000)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported file "sock"`)
+}
+
+func TestTarballBackupModule_InterruptedRestore(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	writeTestFile(t, filepath.Join(dataDir, "state"), "state v1")
+
+	tarball, err := NewTarballBackupModule("file://"+t.TempDir(), dataDir, true)
+	require.NoError(t, err)
+
+	writeTestFile(t, filepath.Join(dataDir, previousDirName, "state"), "state v0")
+	name, err := tarball.Backup(1000)
+	require.NoError(t, err)
+
+	manifest, err := ReadManifest(context.Background(), tarball.store, name)
+	require.NoError(t, err)
+	require.Len(t, manifest.Files, 1, "restore work directories are not archived")
+
+	require.Error(t, tarball.Restore(name), "former content left by an interrupted restore is never overwritten")
+	assertFileContent(t, filepath.Join(dataDir, previousDirName, "state"), "state v0")
+}
+
+func TestTarballBackupModuleFactory_Invalid(t *testing.T) {
+	_, err := TarballBackupModuleFactory(BackupModuleConfig{"type": "tarball", "path": "/data"})
+	require.Error(t, err)
+
+	_, err = TarballBackupModuleFactory(BackupModuleConfig{"type": "tarball", "store": "file:///tmp"})
+	require.Error(t, err)
+
+	_, err = TarballBackupModuleFactory(BackupModuleConfig{"type": "tarball", "store": "file:///tmp", "path": "/data", "compression": "gzip"})
+	require.Error(t, err)
+}
+
+func assertNoRestoreWorkDirectories(t *testing.T, dataDir string) {
+	t.Helper()
+
+	for _, name := range []string{restoringDirName, previousDirName} {
+		_, err := os.Lstat(filepath.Join(dataDir, name))
+		assert.True(t, os.IsNotExist(err), "restore work directory %q should have been cleaned up", name)
+	}
+}
+
+func assertFileContent(t *testing.T, path string, expected string) {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(content))
+}
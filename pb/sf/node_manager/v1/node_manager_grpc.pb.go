@@ -0,0 +1,391 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: sf/node_manager/v1/node_manager.proto
+
+package pbnodemanager
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// NodeManagerClient is the client API for NodeManager service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type NodeManagerClient interface {
+	// Start starts the managed process, resuming it from maintenance
+	Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	// Maintenance stops the managed process until the next Start
+	Maintenance(ctx context.Context, in *MaintenanceRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	Reload(ctx context.Context, in *ReloadRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*CommandResponse, error)
+	ListBackups(ctx context.Context, in *ListBackupsRequest, opts ...grpc.CallOption) (*ListBackupsResponse, error)
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// StreamLogs sends the lines logged by the managed process until the client goes away
+	StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (NodeManager_StreamLogsClient, error)
+}
+
+type nodeManagerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewNodeManagerClient(cc grpc.ClientConnInterface) NodeManagerClient {
+	return &nodeManagerClient{cc}
+}
+
+func (c *nodeManagerClient) Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/sf.node_manager.v1.NodeManager/Start", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeManagerClient) Maintenance(ctx context.Context, in *MaintenanceRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/sf.node_manager.v1.NodeManager/Maintenance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeManagerClient) Reload(ctx context.Context, in *ReloadRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/sf.node_manager.v1.NodeManager/Reload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeManagerClient) Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/sf.node_manager.v1.NodeManager/Backup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeManagerClient) Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*CommandResponse, error) {
+	out := new(CommandResponse)
+	err := c.cc.Invoke(ctx, "/sf.node_manager.v1.NodeManager/Restore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeManagerClient) ListBackups(ctx context.Context, in *ListBackupsRequest, opts ...grpc.CallOption) (*ListBackupsResponse, error) {
+	out := new(ListBackupsResponse)
+	err := c.cc.Invoke(ctx, "/sf.node_manager.v1.NodeManager/ListBackups", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeManagerClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, "/sf.node_manager.v1.NodeManager/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeManagerClient) StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (NodeManager_StreamLogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &NodeManager_ServiceDesc.Streams[0], "/sf.node_manager.v1.NodeManager/StreamLogs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &nodeManagerStreamLogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type NodeManager_StreamLogsClient interface {
+	Recv() (*LogLine, error)
+	grpc.ClientStream
+}
+
+type nodeManagerStreamLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *nodeManagerStreamLogsClient) Recv() (*LogLine, error) {
+	m := new(LogLine)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NodeManagerServer is the server API for NodeManager service.
+// All implementations must embed UnimplementedNodeManagerServer
+// for forward compatibility
+type NodeManagerServer interface {
+	// Start starts the managed process, resuming it from maintenance
+	Start(context.Context, *StartRequest) (*CommandResponse, error)
+	// Maintenance stops the managed process until the next Start
+	Maintenance(context.Context, *MaintenanceRequest) (*CommandResponse, error)
+	Reload(context.Context, *ReloadRequest) (*CommandResponse, error)
+	Backup(context.Context, *BackupRequest) (*CommandResponse, error)
+	Restore(context.Context, *RestoreRequest) (*CommandResponse, error)
+	ListBackups(context.Context, *ListBackupsRequest) (*ListBackupsResponse, error)
+	Status(context.Context, *StatusRequest) (*StatusResponse, error)
+	// StreamLogs sends the lines logged by the managed process until the client goes away
+	StreamLogs(*StreamLogsRequest, NodeManager_StreamLogsServer) error
+	mustEmbedUnimplementedNodeManagerServer()
+}
+
+// UnimplementedNodeManagerServer must be embedded to have forward compatible implementations.
+type UnimplementedNodeManagerServer struct {
+}
+
+func (UnimplementedNodeManagerServer) Start(context.Context, *StartRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
+}
+func (UnimplementedNodeManagerServer) Maintenance(context.Context, *MaintenanceRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Maintenance not implemented")
+}
+func (UnimplementedNodeManagerServer) Reload(context.Context, *ReloadRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reload not implemented")
+}
+func (UnimplementedNodeManagerServer) Backup(context.Context, *BackupRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Backup not implemented")
+}
+func (UnimplementedNodeManagerServer) Restore(context.Context, *RestoreRequest) (*CommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
+func (UnimplementedNodeManagerServer) ListBackups(context.Context, *ListBackupsRequest) (*ListBackupsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBackups not implemented")
+}
+func (UnimplementedNodeManagerServer) Status(context.Context, *StatusRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedNodeManagerServer) StreamLogs(*StreamLogsRequest, NodeManager_StreamLogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLogs not implemented")
+}
+func (UnimplementedNodeManagerServer) mustEmbedUnimplementedNodeManagerServer() {}
+
+// UnsafeNodeManagerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to NodeManagerServer will
+// result in compilation errors.
+type UnsafeNodeManagerServer interface {
+	mustEmbedUnimplementedNodeManagerServer()
+}
+
+func RegisterNodeManagerServer(s grpc.ServiceRegistrar, srv NodeManagerServer) {
+	s.RegisterService(&NodeManager_ServiceDesc, srv)
+}
+
+func _NodeManager_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeManagerServer).Start(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.node_manager.v1.NodeManager/Start",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeManagerServer).Start(ctx, req.(*StartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeManager_Maintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeManagerServer).Maintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.node_manager.v1.NodeManager/Maintenance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeManagerServer).Maintenance(ctx, req.(*MaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeManager_Reload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeManagerServer).Reload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.node_manager.v1.NodeManager/Reload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeManagerServer).Reload(ctx, req.(*ReloadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeManager_Backup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BackupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeManagerServer).Backup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.node_manager.v1.NodeManager/Backup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeManagerServer).Backup(ctx, req.(*BackupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeManager_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeManagerServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.node_manager.v1.NodeManager/Restore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeManagerServer).Restore(ctx, req.(*RestoreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeManager_ListBackups_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBackupsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeManagerServer).ListBackups(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.node_manager.v1.NodeManager/ListBackups",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeManagerServer).ListBackups(ctx, req.(*ListBackupsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeManager_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeManagerServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sf.node_manager.v1.NodeManager/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeManagerServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeManager_StreamLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NodeManagerServer).StreamLogs(m, &nodeManagerStreamLogsServer{stream})
+}
+
+type NodeManager_StreamLogsServer interface {
+	Send(*LogLine) error
+	grpc.ServerStream
+}
+
+type nodeManagerStreamLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *nodeManagerStreamLogsServer) Send(m *LogLine) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// NodeManager_ServiceDesc is the grpc.ServiceDesc for NodeManager service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var NodeManager_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sf.node_manager.v1.NodeManager",
+	HandlerType: (*NodeManagerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Start",
+			Handler:    _NodeManager_Start_Handler,
+		},
+		{
+			MethodName: "Maintenance",
+			Handler:    _NodeManager_Maintenance_Handler,
+		},
+		{
+			MethodName: "Reload",
+			Handler:    _NodeManager_Reload_Handler,
+		},
+		{
+			MethodName: "Backup",
+			Handler:    _NodeManager_Backup_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _NodeManager_Restore_Handler,
+		},
+		{
+			MethodName: "ListBackups",
+			Handler:    _NodeManager_ListBackups_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _NodeManager_Status_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLogs",
+			Handler:       _NodeManager_StreamLogs_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sf/node_manager/v1/node_manager.proto",
+}
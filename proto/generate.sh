@@ -0,0 +1,30 @@
+#!/usr/bin/env bash
+# Copyright 2019 dfuse Platform Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+ROOT="$( cd "$( dirname "${BASH_SOURCE[0]}" )/.." && pwd )"
+
+set -e
+
+# Requires protoc, protoc-gen-go (v1.28.0) and protoc-gen-go-grpc (v1.2.0)
+function main() {
+  cd "$ROOT/proto" &> /dev/null
+
+  protoc -I. \
+    --go_out=paths=source_relative:"$ROOT/pb" \
+    --go-grpc_out=paths=source_relative:"$ROOT/pb" \
+    sf/node_manager/v1/node_manager.proto
+}
+
+main "$@"
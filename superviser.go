@@ -15,6 +15,10 @@
 package node_manager
 
 import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"time"
 
 	logplugin "github.com/streamingfast/node-manager/log_plugin"
@@ -53,6 +57,118 @@ type ChainSuperviser interface {
 	LastSeenBlockNum() uint64
 }
 
+// ExitStatusChainSuperviser is implemented by supervisers able to report details
+// about how the last process execution ended.
+type ExitStatusChainSuperviser interface {
+	LastExitStatus() *ProcessExitStatus
+}
+
+type ProcessExitStatus struct {
+	PID      int
+	ExitCode int
+	// Signal is the name of the signal that terminated the process, empty if it exited by itself
+	Signal    string
+	StartedAt time.Time
+	StoppedAt time.Time
+	Runtime   time.Duration
+	// StoppedBy is the step of the stop sequence that ended the process, empty if it exited by itself
+	StoppedBy StopStep
+}
+
+type StopStep string
+
+const (
+	// StopStepSignal is the configured stop signal, SIGTERM by default
+	StopStepSignal StopStep = "stop_signal"
+	// StopStepKill is the SIGKILL sent once the stop grace period elapsed
+	StopStepKill StopStep = "kill"
+)
+
+// ProcessInfoChainSuperviser is implemented by supervisers able to report details
+// about the current process execution.
+type ProcessInfoChainSuperviser interface {
+	ProcessInfo() *ProcessInfo
+}
+
+type ProcessInfo struct {
+	// State is the overseer state of the process, like "running" or "stopping"
+	State     string
+	PID       int
+	StartedAt time.Time
+}
+
+// ResourceUsageChainSuperviser is implemented by supervisers sampling the resource
+// usage of the process.
+type ResourceUsageChainSuperviser interface {
+	LastResourceSample() *ResourceSample
+}
+
+type ResourceSample struct {
+	PID       int
+	SampledAt time.Time
+	// CPUSeconds is the user and system CPU time consumed since the process started
+	CPUSeconds float64
+	// CPUPercent is the CPU usage since the previous sample, 100 being one core fully used
+	CPUPercent    float64
+	ResidentBytes uint64
+	OpenFDs       int
+	Threads       int
+	// IOReadBytes and IOWriteBytes are the bytes read from and written to storage since the process started
+	IOReadBytes  uint64
+	IOWriteBytes uint64
+}
+
+// CommandSwappableChainSuperviser is implemented by supervisers able to run a
+// different command, like an upgraded binary, the next time they start.
+type CommandSwappableChainSuperviser interface {
+	CommandSpec() *CommandSpec
+	// ValidateCommandSpec checks that `spec` could be run by the superviser
+	ValidateCommandSpec(spec *CommandSpec) error
+	SetCommandSpec(spec *CommandSpec) error
+}
+
+// CommandSpec is the command run by a superviser
+type CommandSpec struct {
+	Binary    string   `json:"binary"`
+	Arguments []string `json:"arguments"`
+	// Env is inherited from the manager process when nil and empty when set to an empty list
+	Env []string `json:"env"`
+}
+
+// Validate checks that the binary resolves to an executable file, looking it up in
+// the PATH when it is not a path and relative to `workingDir`, the directory the
+// process runs in, when it is a relative path. It also checks that the environment
+// variables are `KEY=value` pairs.
+func (c *CommandSpec) Validate(workingDir string) error {
+	if c.Binary == "" {
+		return fmt.Errorf("binary is required")
+	}
+
+	binary := c.Binary
+	if strings.ContainsRune(binary, filepath.Separator) && !filepath.IsAbs(binary) {
+		binary = filepath.Join(workingDir, binary)
+	}
+
+	if _, err := exec.LookPath(binary); err != nil {
+		return fmt.Errorf("invalid binary: %w", err)
+	}
+
+	for _, variable := range c.Env {
+		if !strings.Contains(variable, "=") || strings.HasPrefix(variable, "=") {
+			return fmt.Errorf("invalid environment variable %q, expecting KEY=value", variable)
+		}
+	}
+
+	return nil
+}
+
+// ConfigRenderingChainSuperviser is implemented by supervisers rendering the
+// configuration files of the process when starting it.
+type ConfigRenderingChainSuperviser interface {
+	// PendingConfigChanges returns the configuration files that would change if the process was started now
+	PendingConfigChanges() ([]string, error)
+}
+
 type MonitorableChainSuperviser interface {
 	Monitor()
 }
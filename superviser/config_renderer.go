@@ -0,0 +1,221 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package superviser
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pmezard/go-difflib/difflib"
+	nodeManager "github.com/streamingfast/node-manager"
+)
+
+// ConfigRenderer renders the node configuration files from Go templates each time
+// the superviser starts the process, so they follow the host and the environment
+// instead of being copied once.
+//
+// Templates are executed with the `ConfigVars` as data, like:
+//
+//	agent-name = {{ .Hostname }}
+//	p2p-listen-endpoint = 0.0.0.0:{{ .Ports.p2p }}
+//	{{ range .Peers }}p2p-peer-address = {{ . }}
+//	{{ end }}
+//
+// Referencing a missing map key fails the rendering.
+type ConfigRenderer struct {
+	Templates []*ConfigTemplate
+	Vars      *ConfigVars
+}
+
+type ConfigTemplate struct {
+	// Source is the template file
+	Source string
+	// Destination is the rendered file, relative paths are resolved against the superviser working directory
+	Destination string
+}
+
+// ConfigVars are the variables available to the templates
+type ConfigVars struct {
+	// Hostname defaults to the host name reported by the kernel
+	Hostname string
+	DataDir  string
+	Ports    map[string]int
+	Peers    []string
+	// Env holds the environment of the process, the superviser `Env` or the manager
+	// environment when it is nil, completed by these values
+	Env map[string]string
+	// Extra holds free-form variables
+	Extra map[string]string
+}
+
+// ConfigChange is a rendered file whose content differs from its previous render
+type ConfigChange struct {
+	Destination string
+	// Created is set when the file did not exist yet
+	Created bool
+	// Diff is the unified diff from the previous content, it may contain secrets
+	Diff string
+}
+
+var configTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// Render renders every template, writing the files whose content changed. It
+// returns the changes against the previous render, nothing is written when a
+// template fails.
+func (r *ConfigRenderer) Render(workingDir string, env []string) ([]*ConfigChange, error) {
+	return r.render(workingDir, env, true)
+}
+
+// PendingChanges returns the changes a render would produce without writing them
+func (r *ConfigRenderer) PendingChanges(workingDir string, env []string) ([]*ConfigChange, error) {
+	return r.render(workingDir, env, false)
+}
+
+func (r *ConfigRenderer) render(workingDir string, env []string, write bool) ([]*ConfigChange, error) {
+	vars, err := r.vars(env)
+	if err != nil {
+		return nil, err
+	}
+
+	type rendered struct {
+		destination string
+		content     []byte
+		mode        os.FileMode
+		change      *ConfigChange
+	}
+
+	var renders []*rendered
+	for _, tmpl := range r.Templates {
+		content, mode, err := renderConfigTemplate(tmpl.Source, vars)
+		if err != nil {
+			return nil, err
+		}
+
+		destination := tmpl.Destination
+		if !filepath.IsAbs(destination) {
+			destination = filepath.Join(workingDir, destination)
+		}
+
+		change, err := configChange(destination, content)
+		if err != nil {
+			return nil, err
+		}
+
+		renders = append(renders, &rendered{destination, content, mode, change})
+	}
+
+	var changes []*ConfigChange
+	for _, render := range renders {
+		if render.change == nil {
+			continue
+		}
+
+		if write {
+			if err := nodeManager.WriteFileAtomically(render.destination, render.content, render.mode); err != nil {
+				return changes, fmt.Errorf("write rendered config %q: %w", render.destination, err)
+			}
+		}
+
+		changes = append(changes, render.change)
+	}
+
+	return changes, nil
+}
+
+func (r *ConfigRenderer) vars(env []string) (*ConfigVars, error) {
+	vars := &ConfigVars{Env: map[string]string{}}
+	if r.Vars != nil {
+		*vars = *r.Vars
+		vars.Env = map[string]string{}
+	}
+
+	if vars.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve hostname: %w", err)
+		}
+		vars.Hostname = hostname
+	}
+
+	if env == nil {
+		env = os.Environ()
+	}
+
+	for _, variable := range env {
+		if key, value, found := strings.Cut(variable, "="); found {
+			vars.Env[key] = value
+		}
+	}
+
+	if r.Vars != nil {
+		for key, value := range r.Vars.Env {
+			vars.Env[key] = value
+		}
+	}
+
+	return vars, nil
+}
+
+func renderConfigTemplate(source string, vars *ConfigVars) ([]byte, os.FileMode, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, 0, fmt.Errorf("config template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(source)).Funcs(configTemplateFuncs).Option("missingkey=error").ParseFiles(source)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parse config template %q: %w", source, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return nil, 0, fmt.Errorf("render config template %q: %w", source, err)
+	}
+
+	return out.Bytes(), info.Mode().Perm(), nil
+}
+
+// configChange compares `content` with the current content of `destination`, it
+// returns nil when they are identical
+func configChange(destination string, content []byte) (*ConfigChange, error) {
+	previous, err := os.ReadFile(destination)
+	created := os.IsNotExist(err)
+	if err != nil && !created {
+		return nil, fmt.Errorf("read previous config %q: %w", destination, err)
+	}
+
+	if !created && bytes.Equal(previous, content) {
+		return nil, nil
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(previous)),
+		B:        difflib.SplitLines(string(content)),
+		FromFile: "previous",
+		ToFile:   "rendered",
+		Context:  1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("diff config %q: %w", destination, err)
+	}
+
+	return &ConfigChange{Destination: destination, Created: created, Diff: diff}, nil
+}
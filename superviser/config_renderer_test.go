@@ -0,0 +1,80 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package superviser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigRenderer_Render(t *testing.T) {
+	dir := t.TempDir()
+	workingDir := filepath.Join(dir, "work")
+
+	source := filepath.Join(dir, "config.ini.gotmpl")
+	require.NoError(t, os.WriteFile(source, []byte("agent-name = {{ .Hostname }}\np2p = 0.0.0.0:{{ .Ports.p2p }}\npeers = {{ join .Peers \",\" }}\nkey = {{ .Env.NODE_KEY }}\n"), 0600))
+
+	renderer := &ConfigRenderer{
+		Templates: []*ConfigTemplate{{Source: source, Destination: "config/config.ini"}},
+		Vars: &ConfigVars{
+			Hostname: "node-1",
+			Ports:    map[string]int{"p2p": 9876},
+			Peers:    []string{"a:9876", "b:9876"},
+			Env:      map[string]string{"NODE_KEY": "override"},
+		},
+	}
+
+	destination := filepath.Join(workingDir, "config", "config.ini")
+
+	changes, err := renderer.Render(workingDir, []string{"NODE_KEY=secret"})
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, destination, changes[0].Destination)
+	assert.True(t, changes[0].Created)
+	assertFileContent(t, destination, "agent-name = node-1\np2p = 0.0.0.0:9876\npeers = a:9876,b:9876\nkey = override\n")
+
+	info, err := os.Stat(destination)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "rendered file has the template permissions")
+
+	changes, err = renderer.Render(workingDir, nil)
+	require.NoError(t, err)
+	assert.Empty(t, changes, "identical render")
+
+	renderer.Vars.Hostname = "node-2"
+	changes, err = renderer.PendingChanges(workingDir, nil)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.False(t, changes[0].Created)
+	assert.Contains(t, changes[0].Diff, "-agent-name = node-1\n+agent-name = node-2\n")
+	assertFileContent(t, destination, "agent-name = node-1\np2p = 0.0.0.0:9876\npeers = a:9876,b:9876\nkey = override\n")
+
+	renderer.Vars.Ports = nil
+	_, err = renderer.Render(workingDir, nil)
+	require.Error(t, err, "missing port")
+	assertFileContent(t, destination, "agent-name = node-1\np2p = 0.0.0.0:9876\npeers = a:9876,b:9876\nkey = override\n")
+}
+
+func assertFileContent(t *testing.T, path, expected string) {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(content))
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package superviser
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ShinyTrinkets/overseer"
+	nodeManager "github.com/streamingfast/node-manager"
+	"github.com/streamingfast/node-manager/metrics"
+	"go.uber.org/zap"
+)
+
+const defaultResourceSampleInterval = 15 * time.Second
+
+// processPIDTimeout bounds the wait for the process to be spawned before sampling it
+const processPIDTimeout = 5 * time.Second
+
+// LastResourceSample returns the latest resource usage sample of the process, it is
+// kept once the process stopped and reset when it starts again. Nil when no sample
+// was taken yet.
+func (s *Superviser) LastResourceSample() *nodeManager.ResourceSample {
+	s.lastResourceSampleLock.RLock()
+	defer s.lastResourceSampleLock.RUnlock()
+
+	return s.lastResourceSample
+}
+
+func (s *Superviser) setLastResourceSample(sample *nodeManager.ResourceSample) {
+	s.lastResourceSampleLock.Lock()
+	defer s.lastResourceSampleLock.Unlock()
+
+	s.lastResourceSample = sample
+}
+
+func (s *Superviser) resourceSampleInterval() time.Duration {
+	if s.ResourceSampleInterval == 0 {
+		return defaultResourceSampleInterval
+	}
+
+	return s.ResourceSampleInterval
+}
+
+func (s *Superviser) resourceMetricsInstance() string {
+	if s.ResourceMetricsInstance != "" {
+		return s.ResourceMetricsInstance
+	}
+
+	return filepath.Base(s.Binary)
+}
+
+// sampleResources samples the resource usage of the process until it exits,
+// exporting each sample through the metrics set
+func (s *Superviser) sampleResources(cmd *overseer.Cmd) {
+	interval := s.resourceSampleInterval()
+	if interval < 0 || !resourceSamplingSupported {
+		return
+	}
+
+	pid, err := waitForPID(cmd, processPIDTimeout)
+	if err != nil {
+		s.Logger.Debug("unable to sample process resource usage", zap.Error(err))
+		return
+	}
+
+	instance := s.resourceMetricsInstance()
+	defer deleteResourceMetrics(instance)
+
+	var previous *nodeManager.ResourceSample
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sample, err := readResourceSample(pid)
+		if err != nil {
+			// Expected when the process exits between two samples
+			s.Logger.Debug("unable to sample process resource usage", zap.Int("pid", pid), zap.Error(err))
+		} else {
+			if previous != nil {
+				sample.CPUPercent = cpuPercent(previous, sample)
+			}
+			previous = sample
+
+			s.setLastResourceSample(sample)
+			exportResourceMetrics(instance, sample)
+		}
+
+		select {
+		case <-cmd.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func cpuPercent(previous, current *nodeManager.ResourceSample) float64 {
+	elapsed := current.SampledAt.Sub(previous.SampledAt).Seconds()
+	if elapsed <= 0 || current.CPUSeconds < previous.CPUSeconds {
+		return 0
+	}
+
+	return (current.CPUSeconds - previous.CPUSeconds) / elapsed * 100
+}
+
+func exportResourceMetrics(instance string, sample *nodeManager.ResourceSample) {
+	metrics.ProcessCPUSeconds.SetFloat64(sample.CPUSeconds, instance)
+	metrics.ProcessResidentMemory.SetUint64(sample.ResidentBytes, instance)
+	metrics.ProcessOpenFDs.SetInt(sample.OpenFDs, instance)
+	metrics.ProcessThreads.SetInt(sample.Threads, instance)
+	metrics.ProcessIOReadBytes.SetUint64(sample.IOReadBytes, instance)
+	metrics.ProcessIOWriteBytes.SetUint64(sample.IOWriteBytes, instance)
+}
+
+// deleteResourceMetrics removes the series of a stopped process, so they are not
+// reported with the values of its last sample
+func deleteResourceMetrics(instance string) {
+	metrics.ProcessCPUSeconds.Native().DeleteLabelValues(instance)
+	metrics.ProcessResidentMemory.Native().DeleteLabelValues(instance)
+	metrics.ProcessOpenFDs.Native().DeleteLabelValues(instance)
+	metrics.ProcessThreads.Native().DeleteLabelValues(instance)
+	metrics.ProcessIOReadBytes.Native().DeleteLabelValues(instance)
+	metrics.ProcessIOWriteBytes.Native().DeleteLabelValues(instance)
+}
+
+func waitForPID(cmd *overseer.Cmd, timeout time.Duration) (int, error) {
+	deadline := time.After(timeout)
+	for {
+		if pid := cmd.Status().PID; pid != 0 {
+			return pid, nil
+		}
+
+		select {
+		case <-cmd.Done():
+			return 0, fmt.Errorf("process exited before its PID was known")
+		case <-deadline:
+			return 0, fmt.Errorf("process not spawned after %s", timeout)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
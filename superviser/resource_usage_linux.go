@@ -0,0 +1,158 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package superviser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	nodeManager "github.com/streamingfast/node-manager"
+)
+
+const resourceSamplingSupported = true
+
+// clockTicksPerSecond is the unit of the CPU times in `/proc/<pid>/stat`, it is
+// fixed to 100 on every architecture Linux exposes to user space
+const clockTicksPerSecond = 100
+
+func readResourceSample(pid int) (*nodeManager.ResourceSample, error) {
+	procDir := fmt.Sprintf("/proc/%d", pid)
+	sample := &nodeManager.ResourceSample{PID: pid, SampledAt: time.Now()}
+
+	stat, err := os.ReadFile(procDir + "/stat")
+	if err != nil {
+		return nil, fmt.Errorf("read process stat: %w", err)
+	}
+
+	if err := parseProcStat(stat, sample); err != nil {
+		return nil, err
+	}
+
+	openFDs, err := countDirEntries(procDir + "/fd")
+	if err != nil {
+		return nil, fmt.Errorf("list process file descriptors: %w", err)
+	}
+	sample.OpenFDs = openFDs
+
+	ioFile, err := os.Open(procDir + "/io")
+	if err != nil {
+		return nil, fmt.Errorf("open process io: %w", err)
+	}
+	defer ioFile.Close()
+
+	scanner := bufio.NewScanner(ioFile)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		var target *uint64
+		switch key {
+		case "read_bytes":
+			target = &sample.IOReadBytes
+		case "write_bytes":
+			target = &sample.IOWriteBytes
+		default:
+			continue
+		}
+
+		if *target, err = strconv.ParseUint(strings.TrimSpace(value), 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid process io %s: %w", key, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read process io: %w", err)
+	}
+
+	return sample, nil
+}
+
+// parseProcStat fills the CPU, memory and thread fields of `sample` from the
+// content of `/proc/<pid>/stat`, see proc(5)
+func parseProcStat(stat []byte, sample *nodeManager.ResourceSample) error {
+	// The command name is between parentheses and may contain spaces and parentheses
+	end := bytes.LastIndexByte(stat, ')')
+	if end == -1 {
+		return fmt.Errorf("invalid process stat, command name not found")
+	}
+
+	// Fields after the command name, starting at the third one (state)
+	fields := strings.Fields(string(stat[end+1:]))
+	field := func(number int) (uint64, error) {
+		index := number - 3
+		if index >= len(fields) {
+			return 0, fmt.Errorf("invalid process stat, field %d missing", number)
+		}
+
+		value, err := strconv.ParseUint(fields[index], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid process stat field %d: %w", number, err)
+		}
+
+		return value, nil
+	}
+
+	utime, err := field(14)
+	if err != nil {
+		return err
+	}
+
+	stime, err := field(15)
+	if err != nil {
+		return err
+	}
+
+	threads, err := field(20)
+	if err != nil {
+		return err
+	}
+
+	rssPages, err := field(24)
+	if err != nil {
+		return err
+	}
+
+	sample.CPUSeconds = float64(utime+stime) / clockTicksPerSecond
+	sample.Threads = int(threads)
+	sample.ResidentBytes = rssPages * uint64(os.Getpagesize())
+	return nil
+}
+
+// countDirEntries counts the entries of `dir` without stating them, a file descriptor
+// may be closed between listing and stating it
+func countDirEntries(dir string) (int, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(names), nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package superviser
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	nodeManager "github.com/streamingfast/node-manager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadResourceSample(t *testing.T) {
+	sample, err := readResourceSample(os.Getpid())
+	require.NoError(t, err)
+
+	assert.Equal(t, os.Getpid(), sample.PID)
+	assert.Greater(t, sample.ResidentBytes, uint64(0))
+	assert.Greater(t, sample.OpenFDs, 0)
+	assert.Greater(t, sample.Threads, 0)
+
+	_, err = readResourceSample(0)
+	assert.Error(t, err)
+}
+
+func TestParseProcStat(t *testing.T) {
+	stat := "42 (node (v1) x) S 1 42 42 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 7 0 100 1000000 300 18446744073709551615"
+
+	sample := &nodeManager.ResourceSample{}
+	require.NoError(t, parseProcStat([]byte(stat), sample))
+	assert.Equal(t, 3.0, sample.CPUSeconds)
+	assert.Equal(t, 7, sample.Threads)
+	assert.Equal(t, uint64(300*os.Getpagesize()), sample.ResidentBytes)
+
+	assert.Error(t, parseProcStat([]byte("42 node S 1"), sample))
+	assert.Error(t, parseProcStat([]byte("42 (node) S 1 42"), sample))
+}
+
+func TestCPUPercent(t *testing.T) {
+	now := time.Now()
+	previous := &nodeManager.ResourceSample{SampledAt: now, CPUSeconds: 10}
+
+	assert.Equal(t, 150.0, cpuPercent(previous, &nodeManager.ResourceSample{SampledAt: now.Add(2 * time.Second), CPUSeconds: 13}))
+	assert.Equal(t, 0.0, cpuPercent(previous, &nodeManager.ResourceSample{SampledAt: now, CPUSeconds: 13}))
+}
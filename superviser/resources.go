@@ -0,0 +1,168 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package superviser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+)
+
+// RlimitInfinity lifts a resource limit
+const RlimitInfinity = ^uint64(0)
+
+// ResourceLimits confines the supervised process so it cannot starve the manager.
+// The manager binary is re-executed to apply them to itself right before executing
+// the node binary, the process and its children run confined from the start. The
+// manager main must call `RunConfinedIfRequested` first thing for this to work. Only
+// supported on Linux.
+type ResourceLimits struct {
+	// Rlimits sets the soft and hard limits of resources like "NOFILE", "STACK" or "CORE"
+	Rlimits map[string]Rlimit
+
+	// Nice is the scheduling priority of the process, from -20 (highest) to 19, nil
+	// leaves it unchanged. Lowering it requires the CAP_SYS_NICE capability.
+	Nice *int
+
+	// IOClass is the I/O scheduling class of the process, "realtime", "best-effort"
+	// or "idle", IOPriority goes from 0 (highest) to 7 within the realtime and best-effort
+	// classes. Empty leaves it unchanged.
+	IOClass    string
+	IOPriority int
+
+	// CgroupPath is a cgroup v2 directory, like "/sys/fs/cgroup/node-manager/node", the
+	// process joins. It is created when missing, the manager must be allowed to write to it.
+	CgroupPath string
+	// CgroupMemoryMax is written to `memory.max`, in bytes, 0 leaves it unchanged
+	CgroupMemoryMax int64
+	// CgroupCPUMax is written to `cpu.max`, like "200000 100000" for 2 CPUs, empty leaves it unchanged
+	CgroupCPUMax string
+}
+
+type Rlimit struct {
+	Soft uint64
+	Hard uint64
+}
+
+// resourceLimitsEnv holds the JSON encoded limits the re-executed manager binary
+// applies before executing the node binary
+const resourceLimitsEnv = "NODE_MANAGER_RESOURCE_LIMITS"
+
+// confinedErrorPrefix prefixes the error the re-executed manager binary reports before exiting
+const confinedErrorPrefix = "node-manager: unable to apply resource limits: "
+
+var confinedHookCalled int32
+
+// RunConfinedIfRequested must be called first thing in the manager main when resource
+// limits are used. When the process is a manager binary re-executed by a superviser, it
+// applies the limits then replaces itself with the node binary and never returns, it
+// exits with a status of 1 when the limits cannot be applied. Otherwise, it returns
+// right away.
+func RunConfinedIfRequested() {
+	encodedLimits, found := os.LookupEnv(resourceLimitsEnv)
+	if !found {
+		atomic.StoreInt32(&confinedHookCalled, 1)
+		return
+	}
+
+	// Scheduling and I/O priorities are per thread, they must be set by the thread calling exec
+	runtime.LockOSThread()
+	err := execConfined(encodedLimits, os.Args[1:])
+	fmt.Fprintf(os.Stderr, "%s%s\n", confinedErrorPrefix, err)
+	os.Exit(1)
+}
+
+// execConfined applies the limits to the current process then replaces it with
+// `command`, it only returns on error.
+func execConfined(encodedLimits string, command []string) error {
+	limits := &ResourceLimits{}
+	if err := json.Unmarshal([]byte(encodedLimits), limits); err != nil {
+		return fmt.Errorf("invalid limits: %w", err)
+	}
+
+	if len(command) == 0 {
+		return errors.New("no binary to execute")
+	}
+
+	if err := applyResourceLimits(limits); err != nil {
+		return err
+	}
+
+	binary, err := exec.LookPath(command[0])
+	if err != nil {
+		return err
+	}
+
+	if err := os.Unsetenv(resourceLimitsEnv); err != nil {
+		return err
+	}
+
+	return syscall.Exec(binary, command, os.Environ())
+}
+
+// SetResourceLimits validates `limits` and confines the process with them from its next
+// start, nil removes them. The cgroup is created and configured right away, the process
+// only joins it when starting.
+func (s *Superviser) SetResourceLimits(limits *ResourceLimits) error {
+	if limits != nil {
+		if atomic.LoadInt32(&confinedHookCalled) == 0 {
+			return errors.New("resource limits require the manager main to call superviser.RunConfinedIfRequested first")
+		}
+
+		if err := validateResourceLimits(limits); err != nil {
+			return fmt.Errorf("invalid resource limits: %w", err)
+		}
+
+		if limits.CgroupPath != "" {
+			if err := prepareCgroup(limits); err != nil {
+				return fmt.Errorf("cgroup %q: %w", limits.CgroupPath, err)
+			}
+		}
+	}
+
+	s.cmdLock.Lock()
+	defer s.cmdLock.Unlock()
+
+	s.resourceLimits = limits
+	return nil
+}
+
+// confinedCommand returns the command re-executing the manager binary to apply the
+// resource limits before executing the node binary
+func (s *Superviser) confinedCommand() (binary string, arguments []string, env []string, err error) {
+	encodedLimits, err := json.Marshal(s.resourceLimits)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("encode limits: %w", err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("locate manager binary: %w", err)
+	}
+
+	// A nil environment is inherited, it must stay so once the limits variable is removed
+	env = s.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append(append([]string{}, env...), resourceLimitsEnv+"="+string(encodedLimits))
+
+	return executable, append([]string{s.Binary}, s.Arguments...), env, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package superviser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var rlimitResources = map[string]int{
+	"AS":      unix.RLIMIT_AS,
+	"CORE":    unix.RLIMIT_CORE,
+	"MEMLOCK": unix.RLIMIT_MEMLOCK,
+	"NOFILE":  unix.RLIMIT_NOFILE,
+	"NPROC":   unix.RLIMIT_NPROC,
+	"STACK":   unix.RLIMIT_STACK,
+}
+
+var ioClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// validateResourceLimits checks `limits` can be understood, the privileges they require
+// are only checked when the process starts
+func validateResourceLimits(limits *ResourceLimits) error {
+	for name, limit := range limits.Rlimits {
+		if _, found := rlimitResources[rlimitName(name)]; !found {
+			return fmt.Errorf("unknown rlimit resource %q", name)
+		}
+
+		if limit.Soft > limit.Hard {
+			return fmt.Errorf("rlimit %s soft limit %d is above its hard limit %d", name, limit.Soft, limit.Hard)
+		}
+	}
+
+	if limits.Nice != nil && (*limits.Nice < -20 || *limits.Nice > 19) {
+		return fmt.Errorf("nice %d is not between -20 and 19", *limits.Nice)
+	}
+
+	if limits.IOClass != "" {
+		if _, found := ioClasses[limits.IOClass]; !found {
+			return fmt.Errorf("unknown I/O class %q, accepted classes are realtime, best-effort and idle", limits.IOClass)
+		}
+
+		if limits.IOPriority < 0 || limits.IOPriority > 7 {
+			return fmt.Errorf("I/O priority %d is not between 0 and 7", limits.IOPriority)
+		}
+	}
+
+	if limits.CgroupPath == "" && (limits.CgroupMemoryMax != 0 || limits.CgroupCPUMax != "") {
+		return fmt.Errorf("cgroup limits require a cgroup path")
+	}
+
+	if limits.CgroupMemoryMax < 0 {
+		return fmt.Errorf("cgroup memory max %d is negative", limits.CgroupMemoryMax)
+	}
+
+	return nil
+}
+
+func rlimitName(name string) string {
+	return strings.ToUpper(strings.TrimPrefix(name, "RLIMIT_"))
+}
+
+// applyResourceLimits confines the current process, the scheduling and I/O priorities
+// only apply to the calling thread. The limits have been validated and the cgroup
+// prepared by the manager.
+func applyResourceLimits(limits *ResourceLimits) error {
+	for name, limit := range limits.Rlimits {
+		if err := unix.Setrlimit(rlimitResources[rlimitName(name)], &unix.Rlimit{Cur: limit.Soft, Max: limit.Hard}); err != nil {
+			return fmt.Errorf("set rlimit %s: %w", name, err)
+		}
+	}
+
+	if limits.Nice != nil {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, *limits.Nice); err != nil {
+			return fmt.Errorf("set nice %d: %w", *limits.Nice, err)
+		}
+	}
+
+	if limits.IOClass != "" {
+		ioprio := ioClasses[limits.IOClass]<<ioprioClassShift | limits.IOPriority
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(ioprio)); errno != 0 {
+			return fmt.Errorf("set I/O priority %s/%d: %w", limits.IOClass, limits.IOPriority, errno)
+		}
+	}
+
+	if limits.CgroupPath != "" {
+		if err := writeCgroupFile(limits.CgroupPath, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+			return fmt.Errorf("join cgroup %q: %w", limits.CgroupPath, err)
+		}
+	}
+
+	return nil
+}
+
+// prepareCgroup creates the cgroup and writes its limits, the process joins it when starting
+func prepareCgroup(limits *ResourceLimits) error {
+	if err := os.MkdirAll(limits.CgroupPath, 0755); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+
+	if limits.CgroupMemoryMax > 0 {
+		if err := writeCgroupFile(limits.CgroupPath, "memory.max", strconv.FormatInt(limits.CgroupMemoryMax, 10)); err != nil {
+			return err
+		}
+	}
+
+	if limits.CgroupCPUMax != "" {
+		if err := writeCgroupFile(limits.CgroupPath, "cpu.max", limits.CgroupCPUMax); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCgroupFile(cgroupPath, name, value string) error {
+	// Cgroup files must be written in a single write call, `os.WriteFile` does so
+	if err := os.WriteFile(filepath.Join(cgroupPath, name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+
+	return nil
+}
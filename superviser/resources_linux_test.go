@@ -0,0 +1,85 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package superviser
+
+import (
+	"testing"
+	"time"
+
+	logplugin "github.com/streamingfast/node-manager/log_plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuperviser_ResourceLimits(t *testing.T) {
+	superviser := testSuperviserSh(`ulimit -Sn; ulimit -Hn; ulimit -s; nice; echo "$NODE_MANAGER_RESOURCE_LIMITS"; sleep 10`)
+	nice := 5
+	require.NoError(t, superviser.SetResourceLimits(&ResourceLimits{
+		Rlimits:    map[string]Rlimit{"NOFILE": {Soft: 64, Hard: 128}, "RLIMIT_STACK": {Soft: 16 << 20, Hard: RlimitInfinity}},
+		Nice:       &nice,
+		IOClass:    "best-effort",
+		IOPriority: 7,
+	}))
+
+	lineChan := make(chan string, 10)
+	superviser.RegisterLogPlugin(logplugin.LogPluginFunc(func(line string) {
+		lineChan <- line
+	}))
+
+	require.NoError(t, superviser.Start())
+	defer superviser.Stop()
+
+	assert.Equal(t, "64", waitForOutput(t, lineChan, 5*time.Second))
+	assert.Equal(t, "128", waitForOutput(t, lineChan, waitDefaultTimeout))
+	assert.Equal(t, "16384", waitForOutput(t, lineChan, waitDefaultTimeout))
+	assert.Equal(t, "5", waitForOutput(t, lineChan, waitDefaultTimeout))
+	assert.Equal(t, "", waitForOutput(t, lineChan, waitDefaultTimeout), "limits variable is not passed to the node")
+}
+
+func TestSuperviser_SetResourceLimitsInvalid(t *testing.T) {
+	nice := 20
+	for _, limits := range []*ResourceLimits{
+		{Rlimits: map[string]Rlimit{"UNKNOWN": {}}},
+		{Rlimits: map[string]Rlimit{"NOFILE": {Soft: 128, Hard: 64}}},
+		{Nice: &nice},
+		{IOClass: "fastest"},
+		{IOClass: "idle", IOPriority: 8},
+		{CgroupMemoryMax: 1 << 30},
+	} {
+		superviser := testSuperviserSh(`echo "Starting"`)
+
+		assert.Error(t, superviser.SetResourceLimits(limits))
+		assert.Nil(t, superviser.resourceLimits)
+	}
+}
+
+func TestSuperviser_ResourceLimitsStartFailure(t *testing.T) {
+	superviser := New(zlog, "does-not-exist", nil)
+	require.NoError(t, superviser.SetResourceLimits(&ResourceLimits{Rlimits: map[string]Rlimit{"NOFILE": {Soft: 64, Hard: 128}}}))
+
+	lineChan := make(chan string, 10)
+	superviser.RegisterLogPlugin(logplugin.LogPluginFunc(func(line string) {
+		lineChan <- line
+	}))
+
+	require.NoError(t, superviser.Start())
+	defer superviser.Stop()
+
+	assert.Contains(t, waitForOutput(t, lineChan, 5*time.Second), confinedErrorPrefix)
+	assert.Eventually(t, func() bool { return !superviser.IsRunning() }, 5*time.Second, 50*time.Millisecond)
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/ShinyTrinkets/overseer"
@@ -47,13 +48,73 @@ type Superviser struct {
 	Env    []string
 	Logger *zap.Logger
 
+	// StopSignal is sent to the process group to stop the process, defaults to SIGTERM.
+	// Some nodes need SIGINT to flush their state cleanly.
+	StopSignal syscall.Signal
+	// StopGracePeriod is how long the process has to exit after the stop signal before
+	// it is killed with SIGKILL, defaults to 5m when 0. The process is waited for
+	// indefinitely when negative.
+	StopGracePeriod time.Duration
+
+	// WorkingDir is the directory the process runs in, defaults to the manager one
+	WorkingDir string
+
+	// ConfigRenderer, when set, renders the configuration files of the process before
+	// each start, see `ConfigRenderer`
+	ConfigRenderer *ConfigRenderer
+
+	// ResourceSampleInterval is how often the CPU, memory, file descriptors, threads and
+	// I/O usage of the process are sampled, defaults to 15s, sampling is disabled when
+	// negative. Only supported on Linux.
+	ResourceSampleInterval time.Duration
+	// ResourceMetricsInstance is the `instance` label of the resource usage metrics,
+	// defaults to the binary file name
+	ResourceMetricsInstance string
+
 	cmd     *overseer.Cmd
 	cmdLock sync.Mutex
 
+	// resourceLimits confines the process from its start, see `SetResourceLimits`
+	resourceLimits *ResourceLimits
+
 	logPlugins     []logplugin.LogPlugin
 	logPluginsLock sync.RWMutex
 
 	enableDeepMind bool
+
+	lastExitStatus     *nodeManager.ProcessExitStatus
+	lastStopStep       nodeManager.StopStep
+	lastExitStatusLock sync.RWMutex
+
+	lastResourceSample     *nodeManager.ResourceSample
+	lastResourceSampleLock sync.RWMutex
+}
+
+const defaultStopGracePeriod = 5 * time.Minute
+
+// killWaitTimeout bounds the wait for the process to exit once SIGKILL was sent,
+// a process stuck in uninterruptible sleep would otherwise block `Stop` forever
+const killWaitTimeout = 30 * time.Second
+
+var stopSignals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGQUIT": syscall.SIGQUIT,
+}
+
+// ParseStopSignal parses a `StopSignal` like "SIGINT", "sigterm" or "QUIT"
+func ParseStopSignal(in string) (syscall.Signal, error) {
+	name := strings.ToUpper(in)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	signal, found := stopSignals[name]
+	if !found {
+		return 0, fmt.Errorf("invalid stop signal %q, accepted signals are SIGINT, SIGTERM and SIGQUIT", in)
+	}
+
+	return signal, nil
 }
 
 func New(logger *zap.Logger, binary string, arguments []string) *Superviser {
@@ -113,6 +174,9 @@ func (s *Superviser) setDeepMindDebug(enabled bool) {
 }
 
 func (s *Superviser) Stopped() <-chan struct{} {
+	s.cmdLock.Lock()
+	defer s.cmdLock.Unlock()
+
 	if s.cmd != nil {
 		return s.cmd.Done()
 	}
@@ -120,12 +184,194 @@ func (s *Superviser) Stopped() <-chan struct{} {
 }
 
 func (s *Superviser) LastExitCode() int {
+	s.cmdLock.Lock()
+	defer s.cmdLock.Unlock()
+
 	if s.cmd != nil {
 		return s.cmd.Status().Exit
 	}
 	return 0
 }
 
+func (s *Superviser) LastExitStatus() *nodeManager.ProcessExitStatus {
+	s.lastExitStatusLock.RLock()
+	defer s.lastExitStatusLock.RUnlock()
+
+	// The command's done channel is closed before the read loop receives the final status, read it directly when possible
+	if cmd := s.cmd; cmd != nil && cmd.IsFinalState() {
+		status := exitStatusFromOverseer(cmd.Status())
+		status.StoppedBy = s.lastStopStep
+		return status
+	}
+
+	return s.lastExitStatus
+}
+
+func (s *Superviser) setLastStopStep(step nodeManager.StopStep) {
+	s.lastExitStatusLock.Lock()
+	defer s.lastExitStatusLock.Unlock()
+
+	s.lastStopStep = step
+}
+
+func (s *Superviser) getLastStopStep() nodeManager.StopStep {
+	s.lastExitStatusLock.RLock()
+	defer s.lastExitStatusLock.RUnlock()
+
+	return s.lastStopStep
+}
+
+func (s *Superviser) stopSignal() syscall.Signal {
+	if s.StopSignal == 0 {
+		return syscall.SIGTERM
+	}
+
+	return s.StopSignal
+}
+
+func (s *Superviser) stopGracePeriod() time.Duration {
+	if s.StopGracePeriod == 0 {
+		return defaultStopGracePeriod
+	}
+
+	return s.StopGracePeriod
+}
+
+func (s *Superviser) setLastExitStatus(status overseer.Status) {
+	s.lastExitStatusLock.Lock()
+	defer s.lastExitStatusLock.Unlock()
+
+	s.lastExitStatus = exitStatusFromOverseer(status)
+	s.lastExitStatus.StoppedBy = s.lastStopStep
+}
+
+func exitStatusFromOverseer(status overseer.Status) *nodeManager.ProcessExitStatus {
+	exitStatus := &nodeManager.ProcessExitStatus{
+		PID:      status.PID,
+		ExitCode: status.Exit,
+		Runtime:  time.Duration(status.Runtime * float64(time.Second)),
+	}
+
+	// overseer reports signaled processes through an error like "signal: killed"
+	if status.Error != nil && strings.HasPrefix(status.Error.Error(), "signal: ") {
+		exitStatus.Signal = strings.TrimPrefix(status.Error.Error(), "signal: ")
+	}
+
+	if status.StartTs > 0 {
+		exitStatus.StartedAt = time.Unix(0, status.StartTs)
+	}
+
+	if status.StopTs > 0 {
+		exitStatus.StoppedAt = time.Unix(0, status.StopTs)
+	}
+
+	return exitStatus
+}
+
+// ProcessInfo returns the details of the current process execution, nil when the
+// process was never started or was stopped through `Stop`.
+func (s *Superviser) ProcessInfo() *nodeManager.ProcessInfo {
+	// Like `IsRunning`, waits for a `Stop` in progress to release the command lock
+	s.cmdLock.Lock()
+	cmd := s.cmd
+	s.cmdLock.Unlock()
+
+	if cmd == nil {
+		return nil
+	}
+
+	status := cmd.Status()
+	info := &nodeManager.ProcessInfo{
+		State: s.cmdState(cmd).String(),
+		PID:   status.PID,
+	}
+
+	if status.StartTs > 0 {
+		info.StartedAt = time.Unix(0, status.StartTs)
+	}
+
+	return info
+}
+
+// CommandSpec returns the command run by the superviser
+func (s *Superviser) CommandSpec() *nodeManager.CommandSpec {
+	s.cmdLock.Lock()
+	defer s.cmdLock.Unlock()
+
+	return &nodeManager.CommandSpec{
+		Binary:    s.Binary,
+		Arguments: copyStrings(s.Arguments),
+		Env:       copyStrings(s.Env),
+	}
+}
+
+// ValidateCommandSpec checks `spec`, a relative binary path being resolved from `WorkingDir`
+func (s *Superviser) ValidateCommandSpec(spec *nodeManager.CommandSpec) error {
+	return spec.Validate(s.WorkingDir)
+}
+
+// SetCommandSpec validates `spec` and makes it the command run the next time the
+// superviser starts, a running process is left untouched.
+func (s *Superviser) SetCommandSpec(spec *nodeManager.CommandSpec) error {
+	if err := s.ValidateCommandSpec(spec); err != nil {
+		return err
+	}
+
+	s.cmdLock.Lock()
+	defer s.cmdLock.Unlock()
+
+	s.Logger.Info("swapping command", zap.String("binary", spec.Binary), zap.Strings("arguments", spec.Arguments), zap.Int("env_count", len(spec.Env)), zap.Bool("inherit_env", spec.Env == nil))
+	s.Binary = spec.Binary
+	s.Arguments = copyStrings(spec.Arguments)
+	s.Env = copyStrings(spec.Env)
+	return nil
+}
+
+// copyStrings copies `in`, preserving the distinction between nil and empty
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+
+	out := make([]string, len(in))
+	copy(out, in)
+	return out
+}
+
+// PendingConfigChanges returns the destination of the configuration files that
+// would change if the process was started now, nil when no `ConfigRenderer` is set.
+func (s *Superviser) PendingConfigChanges() ([]string, error) {
+	if s.ConfigRenderer == nil {
+		return nil, nil
+	}
+
+	s.cmdLock.Lock()
+	workingDir, env := s.WorkingDir, s.Env
+	s.cmdLock.Unlock()
+
+	changes, err := s.ConfigRenderer.PendingChanges(workingDir, env)
+	if err != nil {
+		return nil, err
+	}
+	s.logConfigChanges("config would change on next start", changes)
+
+	destinations := make([]string, len(changes))
+	for i, change := range changes {
+		destinations[i] = change.Destination
+	}
+
+	return destinations, nil
+}
+
+// logConfigChanges logs which files changed, diffs are only logged at debug level
+// as configuration files often hold secrets
+func (s *Superviser) logConfigChanges(msg string, changes []*ConfigChange) {
+	for _, change := range changes {
+		s.Logger.Info(msg, zap.String("destination", change.Destination), zap.Bool("created", change.Created))
+		s.Logger.Debug("config diff", zap.String("destination", change.Destination), zap.String("diff", change.Diff))
+	}
+}
+
 func (s *Superviser) LastLogLines() []string {
 	if s.hasToConsolePlugin() {
 		// There is no point in showing the last log lines when the user already saw it through the to console log plugin
@@ -168,24 +414,43 @@ func (s *Superviser) Start(options ...nodeManager.StartOption) error {
 	defer s.cmdLock.Unlock()
 
 	if s.cmd != nil {
-		if s.cmd.State == overseer.STARTING || s.cmd.State == overseer.RUNNING {
+		state := s.cmdState(s.cmd)
+		if state == overseer.STARTING || state == overseer.RUNNING {
 			s.Logger.Info("underlying process already running, nothing to do")
 			return nil
 		}
 
-		if s.cmd.State == overseer.STOPPING {
+		if state == overseer.STOPPING {
 			s.Logger.Info("underlying process is currently stopping, waiting for it to finish")
 			<-s.cmd.Done()
 		}
 	}
 
+	if s.ConfigRenderer != nil {
+		changes, err := s.ConfigRenderer.Render(s.WorkingDir, s.Env)
+		if err != nil {
+			return fmt.Errorf("unable to render config: %w", err)
+		}
+		s.logConfigChanges("rendered config changed", changes)
+	}
+
 	s.Logger.Info("creating new command instance and launch read loop", zap.String("binary", s.Binary), zap.Strings("arguments", s.Arguments))
 	var args []interface{}
 	for _, a := range s.Arguments {
 		args = append(args, a)
 	}
 
-	s.cmd = overseer.NewCmd(s.Binary, s.Arguments, overseer.Options{Streaming: true, Env: s.Env})
+	binary, arguments, env := s.Binary, s.Arguments, s.Env
+	if s.resourceLimits != nil {
+		var err error
+		if binary, arguments, env, err = s.confinedCommand(); err != nil {
+			return fmt.Errorf("unable to confine command: %w", err)
+		}
+	}
+
+	s.cmd = overseer.NewCmd(binary, arguments, overseer.Options{Streaming: true, Env: env, Dir: s.WorkingDir})
+	s.setLastStopStep("")
+	s.setLastResourceSample(nil)
 
 	go s.start(s.cmd)
 
@@ -203,58 +468,109 @@ func (s *Superviser) Stop() error {
 		return nil
 	}
 
-	if s.cmd.State == overseer.STARTING || s.cmd.State == overseer.RUNNING {
-		s.Logger.Info("stopping underlying process")
-		err := s.cmd.Stop()
-		if err != nil {
+	cmd := s.cmd
+	gracePeriod := s.stopGracePeriod()
+
+	if state := s.cmdState(cmd); state == overseer.STARTING || state == overseer.RUNNING {
+		signal := s.stopSignal()
+		s.Logger.Info("stopping underlying process", zap.Stringer("signal", signal), zap.Duration("grace_period", gracePeriod))
+		s.setLastStopStep(nodeManager.StopStepSignal)
+
+		if err := signalStop(cmd, signal); err != nil {
 			s.Logger.Error("failed to stop overseer cmd", zap.Error(err))
 			return err
 		}
 	}
 
-	// Blocks until command finished completely
+	// Blocks until command finished completely, killing it once the grace period elapsed
 	s.Logger.Debug("blocking until command actually ends")
 
+	var gracePeriodElapsed, killWaitElapsed <-chan time.Time
+	if gracePeriod > 0 {
+		gracePeriodElapsed = time.After(gracePeriod)
+	}
+
 nodeProcessDone:
 	for {
 		select {
-		case <-s.cmd.Done():
+		case <-cmd.Done():
 			break nodeProcessDone
+		case <-gracePeriodElapsed:
+			gracePeriodElapsed = nil
+			s.Logger.Warn("process did not exit within stop grace period, killing it", zap.Duration("grace_period", gracePeriod))
+			s.setLastStopStep(nodeManager.StopStepKill)
+			if err := cmd.Signal(syscall.SIGKILL); err != nil {
+				s.Logger.Error("failed to kill overseer cmd", zap.Error(err))
+			}
+			killWaitElapsed = time.After(killWaitTimeout)
+		case <-killWaitElapsed:
+			// The read loop holds its own reference to the command, releasing it lets a later `Start` run a new process
+			s.setLastExitStatus(cmd.Status())
+			s.cmd = nil
+
+			return fmt.Errorf("process did not exit %s after being killed", killWaitTimeout)
 		case <-time.After(500 * time.Millisecond):
 			s.Logger.Debug("still blocking until command actually ends")
 		}
 	}
 
-	s.Logger.Info("supervised process has been terminated")
+	s.Logger.Info("supervised process has been terminated", zap.String("stopped_by", string(s.getLastStopStep())))
 
-	s.Logger.Info("waiting for stdout and stderr to be drained", s.getProcessOutputStatsLogFields()...)
+	s.Logger.Info("waiting for stdout and stderr to be drained", getProcessOutputStatsLogFields(cmd)...)
 	for {
-		if s.isBufferEmpty() {
+		if isBufferEmpty(cmd) {
 			break
 		}
 
-		s.Logger.Debug("draining stdout and stderr", s.getProcessOutputStatsLogFields()...)
+		s.Logger.Debug("draining stdout and stderr", getProcessOutputStatsLogFields(cmd)...)
 		time.Sleep(500 * time.Millisecond)
 	}
 
 	s.Logger.Info("stdout and stderr are now drained")
 
-	// Must be after `for { ... }` as `s.cmd` is used within the loop and also before it via call to `getProcessOutputStatsLogFields`
+	// The read loop may not have received the final status yet, it is not readable from the command once released
+	s.setLastExitStatus(cmd.Status())
 	s.cmd = nil
 
 	return nil
 }
 
-func (s *Superviser) getProcessOutputStats() (stdoutLineCount, stderrLineCount int) {
-	if s.cmd != nil {
-		return len(s.cmd.Stdout), len(s.cmd.Stderr)
+// signalStop sends the stop signal to the process group and, like `overseer.Cmd.Stop`
+// does for SIGTERM, makes sure the command is not restarted. overseer only flags
+// SIGTERM stops as stopping, `cmdState` covers the other signals.
+func signalStop(cmd *overseer.Cmd, signal syscall.Signal) error {
+	if signal == syscall.SIGTERM {
+		return cmd.Stop()
 	}
 
-	return
+	cmd.Lock()
+	cmd.RetryTimes = 0
+	cmd.Unlock()
+
+	return cmd.Signal(signal)
 }
 
-func (s *Superviser) getProcessOutputStatsLogFields() []zap.Field {
-	stdoutLineCount, stderrLineCount := s.getProcessOutputStats()
+// cmdState returns the state of the command, reported as stopping once `Stop` signaled it
+// whatever the stop signal is. The state is read under the command lock, overseer updates
+// it from its own goroutine.
+func (s *Superviser) cmdState(cmd *overseer.Cmd) overseer.CmdState {
+	cmd.Lock()
+	state := cmd.State
+	cmd.Unlock()
+
+	if (state == overseer.STARTING || state == overseer.RUNNING) && s.getLastStopStep() != "" {
+		return overseer.STOPPING
+	}
+
+	return state
+}
+
+func getProcessOutputStats(cmd *overseer.Cmd) (stdoutLineCount, stderrLineCount int) {
+	return len(cmd.Stdout), len(cmd.Stderr)
+}
+
+func getProcessOutputStatsLogFields(cmd *overseer.Cmd) []zap.Field {
+	stdoutLineCount, stderrLineCount := getProcessOutputStats(cmd)
 
 	return []zap.Field{zap.Int("stdout_len", stdoutLineCount), zap.Int("stderr_len", stderrLineCount)}
 }
@@ -271,26 +587,29 @@ func (s *Superviser) isRunning() bool {
 	if s.cmd == nil {
 		return false
 	}
-	return s.cmd.State == overseer.STARTING || s.cmd.State == overseer.RUNNING || s.cmd.State == overseer.STOPPING
+
+	state := s.cmdState(s.cmd)
+	return state == overseer.STARTING || state == overseer.RUNNING || state == overseer.STOPPING
 }
 
-func (s *Superviser) isBufferEmpty() bool {
-	if s.cmd == nil {
-		return true
-	}
-	return len(s.cmd.Stdout) == 0 && len(s.cmd.Stderr) == 0
+func isBufferEmpty(cmd *overseer.Cmd) bool {
+	return len(cmd.Stdout) == 0 && len(cmd.Stderr) == 0
 }
 
 func (s *Superviser) start(cmd *overseer.Cmd) {
 	statusChan := cmd.Start()
+	go s.sampleResources(cmd)
 
 	processTerminated := false
 	for {
 		select {
 		case status := <-statusChan:
 			processTerminated = true
-			if status.Exit == 0 {
-				s.Logger.Info("command terminated with zero status", s.getProcessOutputStatsLogFields()...)
+			s.setLastExitStatus(status)
+			if stopStep := s.getLastStopStep(); stopStep != "" {
+				s.Logger.Info("command terminated after a stop request", append(overseerStatusLogFields(status), zap.String("stopped_by", string(stopStep)))...)
+			} else if status.Exit == 0 {
+				s.Logger.Info("command terminated with zero status", getProcessOutputStatsLogFields(cmd)...)
 			} else {
 				s.Logger.Error(fmt.Sprintf("command terminated with non-zero status, last log lines:\n%s\n", formatLogLines(s.LastLogLines())), overseerStatusLogFields(status)...)
 			}
@@ -302,8 +621,8 @@ func (s *Superviser) start(cmd *overseer.Cmd) {
 		}
 
 		if processTerminated {
-			s.Logger.Debug("command terminated but continue read loop to fully consume stdout/sdterr line channels", zap.Bool("buffer_empty", s.isBufferEmpty()))
-			if s.isBufferEmpty() {
+			s.Logger.Debug("command terminated but continue read loop to fully consume stdout/sdterr line channels", zap.Bool("buffer_empty", isBufferEmpty(cmd)))
+			if isBufferEmpty(cmd) {
 				return
 			}
 		}
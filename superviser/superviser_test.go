@@ -16,12 +16,15 @@ package superviser
 
 import (
 	"os"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/streamingfast/logging"
+	nodeManager "github.com/streamingfast/node-manager"
 	logplugin "github.com/streamingfast/node-manager/log_plugin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -42,6 +45,12 @@ func init() {
 	}
 }
 
+func TestMain(m *testing.M) {
+	// The test binary is the manager binary re-executed to apply resource limits
+	RunConfinedIfRequested()
+	os.Exit(m.Run())
+}
+
 var waitDefaultTimeout = 500 * time.Millisecond
 
 func TestSuperviser_NotRunningAfterCreation(t *testing.T) {
@@ -135,3 +144,64 @@ func waitForOutput(t *testing.T, lineChan chan string, timeout time.Duration) (l
 	// Will fail before reaching this line
 	return ""
 }
+
+func TestSuperviser_StopSignal(t *testing.T) {
+	superviser := testSuperviserSh(`trap 'echo "Interrupted"; exit 0' INT; echo "Starting"; while true; do sleep 0.1; done`)
+	superviser.StopSignal = syscall.SIGINT
+	superviser.StopGracePeriod = 5 * time.Second
+
+	lineChan := make(chan string, 10)
+	superviser.RegisterLogPlugin(logplugin.LogPluginFunc(func(line string) {
+		lineChan <- line
+	}))
+
+	go superviser.Start()
+	waitForSuperviserTaskCompletion(superviser)
+	assert.Equal(t, "Starting", waitForOutput(t, lineChan, waitDefaultTimeout))
+
+	require.NoError(t, superviser.Stop())
+	assert.Equal(t, "Interrupted", waitForOutput(t, lineChan, waitDefaultTimeout))
+
+	require.NotNil(t, superviser.LastExitStatus())
+	assert.Equal(t, nodeManager.StopStepSignal, superviser.LastExitStatus().StoppedBy)
+}
+
+func TestSuperviser_StopKillsAfterGracePeriod(t *testing.T) {
+	superviser := testSuperviserSh(`trap '' TERM; echo "Starting"; while true; do sleep 0.1; done`)
+	superviser.StopGracePeriod = 200 * time.Millisecond
+
+	lineChan := make(chan string, 10)
+	superviser.RegisterLogPlugin(logplugin.LogPluginFunc(func(line string) {
+		lineChan <- line
+	}))
+
+	go superviser.Start()
+	waitForSuperviserTaskCompletion(superviser)
+	assert.Equal(t, "Starting", waitForOutput(t, lineChan, waitDefaultTimeout))
+
+	start := time.Now()
+	require.NoError(t, superviser.Stop())
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	require.NotNil(t, superviser.LastExitStatus())
+	assert.Equal(t, nodeManager.StopStepKill, superviser.LastExitStatus().StoppedBy)
+}
+
+func TestSuperviser_StopGracePeriodDefault(t *testing.T) {
+	superviser := &Superviser{}
+	assert.Equal(t, defaultStopGracePeriod, superviser.stopGracePeriod())
+
+	superviser.StopGracePeriod = -1
+	assert.Equal(t, time.Duration(-1), superviser.stopGracePeriod())
+}
+
+func TestParseStopSignal(t *testing.T) {
+	for in, expected := range map[string]syscall.Signal{"SIGINT": syscall.SIGINT, "term": syscall.SIGTERM, "SigQuit": syscall.SIGQUIT} {
+		signal, err := ParseStopSignal(in)
+		require.NoError(t, err)
+		assert.Equal(t, expected, signal, in)
+	}
+
+	_, err := ParseStopSignal("SIGKILL")
+	assert.Error(t, err)
+}
@@ -2,6 +2,8 @@ package node_manager
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"syscall"
 )
 
@@ -21,3 +23,51 @@ func AugmentStackSizeLimit() error {
 
 	return nil
 }
+
+// WriteFileAtomically replaces `path` with `content`, creating its directory when
+// missing. The content is synced to disk before the file is renamed over `path`, so
+// a crash leaves either the previous or the new content, never a partial one.
+func WriteFileAtomically(path string, content []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+
+	// The rename is only durable once the directory is synced
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirFile.Close()
+
+	return dirFile.Sync()
+}